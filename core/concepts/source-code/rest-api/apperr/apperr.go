@@ -0,0 +1,115 @@
+// Package apperr defines the domain errors shared by the repository, the
+// handlers and the middleware, which renders them as HTTP problems.
+package apperr
+
+import (
+	"context"
+	"errors"
+
+	"rest-api/validation"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindBadRequest
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindPreconditionFailed
+	KindPreconditionRequired
+	KindValidation
+	KindTimeout
+	KindUnsupportedMediaType
+	KindUnavailable
+	KindTooManyRequests
+	KindTooLarge
+	KindCanceled
+)
+
+// Error is a domain error. Detail is meant for clients and must not leak
+// internals; Err keeps the underlying cause for logs and errors.Is.
+type Error struct {
+	Kind   Kind
+	Detail string
+	Fields validation.Errors
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func BadRequest(detail string, err error) *Error {
+	return &Error{Kind: KindBadRequest, Detail: detail, Err: err}
+}
+
+func Unauthorized(detail string) *Error {
+	return &Error{Kind: KindUnauthorized, Detail: detail}
+}
+
+func Forbidden(detail string) *Error {
+	return &Error{Kind: KindForbidden, Detail: detail}
+}
+
+func NotFound(detail string, err error) *Error {
+	return &Error{Kind: KindNotFound, Detail: detail, Err: err}
+}
+
+func Conflict(detail string, err error) *Error {
+	return &Error{Kind: KindConflict, Detail: detail, Err: err}
+}
+
+func PreconditionFailed(detail string, err error) *Error {
+	return &Error{Kind: KindPreconditionFailed, Detail: detail, Err: err}
+}
+
+func PreconditionRequired(detail string) *Error {
+	return &Error{Kind: KindPreconditionRequired, Detail: detail}
+}
+
+func UnsupportedMediaType(detail string) *Error {
+	return &Error{Kind: KindUnsupportedMediaType, Detail: detail}
+}
+
+func Unavailable(detail string, err error) *Error {
+	return &Error{Kind: KindUnavailable, Detail: detail, Err: err}
+}
+
+func TooManyRequests(detail string) *Error {
+	return &Error{Kind: KindTooManyRequests, Detail: detail}
+}
+
+func TooLarge(detail string, err error) *Error {
+	return &Error{Kind: KindTooLarge, Detail: detail, Err: err}
+}
+
+func Validation(fields validation.Errors) *Error {
+	return &Error{Kind: KindValidation, Detail: "the request has invalid fields", Fields: fields}
+}
+
+// As returns the outermost *Error in err's chain. Timeouts and cancellations
+// that were not wrapped become KindTimeout and KindCanceled, and anything
+// else KindInternal.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: KindTimeout, Detail: "the request took too long", Err: err}
+	}
+	if errors.Is(err, context.Canceled) {
+		return &Error{Kind: KindCanceled, Detail: "the client closed the request", Err: err}
+	}
+	return &Error{Kind: KindInternal, Detail: "an unexpected error occurred", Err: err}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator turns an Authorization header into claims. It accepts
+// "Bearer <jwt>" and, when APIKeys is set, "ApiKey <key>".
+type Authenticator struct {
+	Keys    KeySet
+	APIKeys *APIKeyStore
+}
+
+// Authenticate returns ErrNoCredentials, ErrInvalidToken or ErrInvalidAPIKey
+// for credentials it rejects, and other errors when it could not check them.
+func (a Authenticator) Authenticate(ctx context.Context, header string) (*Claims, error) {
+	scheme, credentials, _ := strings.Cut(header, " ")
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return a.Keys.Verify(credentials)
+	case strings.EqualFold(scheme, "ApiKey") && a.APIKeys != nil:
+		return a.APIKeys.Resolve(ctx, credentials)
+	}
+	return nil, ErrNoCredentials
+}
+
+// Rejected reports whether err rejects the credentials, rather than telling
+// that they could not be checked.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrNoCredentials) || errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrInvalidAPIKey)
+}
@@ -0,0 +1,310 @@
+// Package bulk streams entities in and out as CSV or NDJSON, one row per
+// entity. Columns and NDJSON fields are named after the json tags, so that
+// both formats read and write what the JSON API does.
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Media types of the supported formats.
+const (
+	CSV    = "text/csv"
+	NDJSON = "application/x-ndjson"
+)
+
+// Formats lists the supported media types.
+var Formats = []string{CSV, NDJSON}
+
+// Format returns the media type of a format name, "csv" or "ndjson".
+func Format(name string) (string, bool) {
+	switch name {
+	case "csv":
+		return CSV, true
+	case "ndjson":
+		return NDJSON, true
+	}
+	return "", false
+}
+
+// ContentType returns the media type of a Content-Type header, when it is a
+// supported one.
+func ContentType(header string) (string, bool) {
+	media, _, err := mime.ParseMediaType(header)
+	if err == nil && (media == CSV || media == NDJSON) {
+		return media, true
+	}
+	return "", false
+}
+
+// RowError is a row that could not be decoded. Reading can go on after it.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// column is a json field of T.
+type column struct {
+	name string
+	// quoted fields are JSON strings, written unquoted in CSV cells.
+	quoted bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func columns[T any]() []column {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	var out []column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		out = append(out, column{name: name, quoted: ft.Kind() == reflect.String || ft == timeType})
+	}
+	return out
+}
+
+// Reader decodes the rows of a stream into T.
+type Reader[T any] struct {
+	csv    *csv.Reader
+	header []column
+	// skip marks the ignored CSV columns.
+	skip    []bool
+	ignore  map[string]bool
+	scanner *bufio.Scanner
+	line    int
+}
+
+// MaxLine bounds the length of an NDJSON line.
+const MaxLine = 1 << 20
+
+// NewReader reads r in format, a media type. A CSV stream starts with a
+// header naming the columns; unknown columns are an error. The columns and
+// NDJSON fields named in ignore are dropped, e.g. the read-only ones of an
+// export being imported back.
+func NewReader[T any](r io.Reader, format string, ignore ...string) (*Reader[T], error) {
+	ignored := map[string]bool{}
+	for _, name := range ignore {
+		ignored[name] = true
+	}
+	switch format {
+	case NDJSON:
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 64<<10), MaxLine)
+		return &Reader[T]{scanner: s, ignore: ignored}, nil
+	case CSV:
+	default:
+		return nil, fmt.Errorf("bulk: unsupported format %q", format)
+	}
+
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	names, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the CSV header is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]column{}
+	for _, c := range columns[T]() {
+		known[c.name] = c
+	}
+	header := make([]column, len(names))
+	skip := make([]bool, len(names))
+	for i, name := range names {
+		c, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		header[i], skip[i] = c, ignored[c.name]
+	}
+	return &Reader[T]{csv: cr, header: header, skip: skip, line: 1}, nil
+}
+
+// Read decodes the next row into entity, which should be zero, and returns
+// its line. It returns io.EOF after the last row, and a *RowError for a
+// malformed row.
+func (r *Reader[T]) Read(entity *T) (int, error) {
+	if r.scanner != nil {
+		return r.readNDJSON(entity)
+	}
+	return r.readCSV(entity)
+}
+
+func (r *Reader[T]) readNDJSON(entity *T) (int, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := r.decode(line, entity); err != nil {
+			return r.line, &RowError{Line: r.line, Err: err}
+		}
+		return r.line, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return r.line + 1, err
+	}
+	return r.line, io.EOF
+}
+
+// decode unmarshals an NDJSON line into entity, without the ignored fields.
+func (r *Reader[T]) decode(line []byte, entity *T) error {
+	if len(r.ignore) == 0 {
+		return json.Unmarshal(line, entity)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return err
+	}
+	for name := range r.ignore {
+		delete(fields, name)
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, entity)
+}
+
+func (r *Reader[T]) readCSV(entity *T) (int, error) {
+	record, err := r.csv.Read()
+	if errors.Is(err, io.EOF) {
+		return r.line, io.EOF
+	}
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		r.line = perr.StartLine
+		return r.line, &RowError{Line: r.line, Err: perr.Err}
+	}
+	if err != nil {
+		return r.line, err
+	}
+	r.line, _ = r.csv.FieldPos(0)
+
+	// The row is turned into a JSON object, so that it decodes exactly like
+	// a request body. Empty cells are left out.
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, cell := range record {
+		if cell == "" || r.skip[i] {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(r.header[i].name)
+		b.Write(name)
+		b.WriteByte(':')
+		switch {
+		case r.header[i].quoted:
+			value, _ := json.Marshal(cell)
+			b.Write(value)
+		case json.Valid([]byte(cell)):
+			b.WriteString(cell)
+		default:
+			return r.line, &RowError{Line: r.line, Err: fmt.Errorf("invalid %s %q", r.header[i].name, cell)}
+		}
+	}
+	b.WriteByte('}')
+	if err := json.Unmarshal(b.Bytes(), entity); err != nil {
+		return r.line, &RowError{Line: r.line, Err: err}
+	}
+	return r.line, nil
+}
+
+// Writer encodes entities of T to a stream.
+type Writer[T any] struct {
+	csv     *csv.Writer
+	columns []column
+	record  []string
+	json    *json.Encoder
+}
+
+// NewWriter writes to w in format, a media type, starting with the header
+// of a CSV stream.
+func NewWriter[T any](w io.Writer, format string) (*Writer[T], error) {
+	switch format {
+	case NDJSON:
+		return &Writer[T]{json: json.NewEncoder(w)}, nil
+	case CSV:
+	default:
+		return nil, fmt.Errorf("bulk: unsupported format %q", format)
+	}
+	cols := columns[T]()
+	out := &Writer[T]{csv: csv.NewWriter(w), columns: cols, record: make([]string, len(cols))}
+	for i, c := range cols {
+		out.record[i] = c.name
+	}
+	return out, out.csv.Write(out.record)
+}
+
+// Write encodes entity as one row.
+func (w *Writer[T]) Write(entity *T) error {
+	if w.json != nil {
+		return w.json.Encode(entity)
+	}
+	b, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for i, c := range w.columns {
+		w.record[i] = cell(fields[c.name])
+	}
+	return w.csv.Write(w.record)
+}
+
+// cell is the CSV cell of a JSON value: strings unquoted, null and missing
+// values empty, anything else as is.
+func cell(v json.RawMessage) string {
+	if len(v) == 0 || string(v) == "null" {
+		return ""
+	}
+	var s string
+	if v[0] == '"' && json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	return string(v)
+}
+
+// Flush writes the buffered rows out.
+func (w *Writer[T]) Flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
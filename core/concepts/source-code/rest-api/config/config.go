@@ -0,0 +1,374 @@
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the service configuration. Load fills it from, in increasing
+// order of precedence:
+//
+//  1. the defaults returned by Default
+//  2. a YAML or TOML file, named by -config or CONFIG_FILE
+//  3. environment variables
+//  4. command line flags
+//
+// Secrets can also be read from files with the *_FILE variables (or the
+// *_file keys), which take precedence over the inline values.
+type Config struct {
+	Addr string    `yaml:"addr" toml:"addr"`
+	DB   DBConfig  `yaml:"db" toml:"db"`
+	JWT  JWTConfig `yaml:"jwt" toml:"jwt"`
+	// ShutdownTimeout bounds the wait for in-flight requests on SIGTERM.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// DrainDelay keeps serving with /readyz failing before the shutdown, so
+	// that load balancers stop routing to the instance first.
+	DrainDelay Duration `yaml:"drain_delay" toml:"drain_delay"`
+	// OutboxWebhookURL receives the domain events; they are logged when it
+	// is empty.
+	OutboxWebhookURL string `yaml:"outbox_webhook_url" toml:"outbox_webhook_url"`
+	// TrustedProxies lists the addresses or CIDRs of the proxies whose
+	// X-Forwarded-For is believed for the client IP. None by default: the
+	// client IP is then the peer address.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// TraceStdout prints the recorded spans on stdout, for local runs.
+	TraceStdout bool `yaml:"trace_stdout" toml:"trace_stdout"`
+	// Args holds the arguments left after the flags, e.g. a subcommand.
+	Args []string `yaml:"-" toml:"-"`
+}
+
+type DBConfig struct {
+	Driver string `yaml:"driver" toml:"driver"`
+	// DSN is used as is when set. Otherwise a Postgres DSN is built from
+	// the fields below.
+	DSN      string `yaml:"dsn" toml:"dsn"`
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	Name     string `yaml:"name" toml:"name"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode"`
+
+	DSNFile      string `yaml:"dsn_file" toml:"dsn_file"`
+	PasswordFile string `yaml:"password_file" toml:"password_file"`
+
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+
+	// QueryTimeout bounds each query of the repositories.
+	QueryTimeout Duration `yaml:"query_timeout" toml:"query_timeout"`
+
+	// AutoMigrate applies pending migrations on startup.
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+}
+
+type JWTConfig struct {
+	Issuer     string `yaml:"issuer" toml:"issuer"`
+	Secret     string `yaml:"secret" toml:"secret"`
+	SecretFile string `yaml:"secret_file" toml:"secret_file"`
+	// PublicKeyFile optionally adds an RS256 verification key under KeyID.
+	PublicKeyFile string `yaml:"public_key_file" toml:"public_key_file"`
+	KeyID         string `yaml:"key_id" toml:"key_id"`
+	// IssueTokens mounts POST /auth/token, which signs tokens with any
+	// roles. It is meant for local development and off by default.
+	IssueTokens bool `yaml:"issue_tokens" toml:"issue_tokens"`
+}
+
+// Duration reads "30s" style durations from config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = Duration(v)
+	return err
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the settings used when nothing else is configured. They
+// match the Postgres service of docker-compose.yaml. There is no default
+// JWT key: a known secret would let anyone sign tokens.
+func Default() Config {
+	return Config{
+		Addr:            ":8080",
+		ShutdownTimeout: Duration(15 * time.Second),
+		DB: DBConfig{
+			Driver:          "postgres",
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "postgres",
+			Name:            "testdb",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(30 * time.Minute),
+			ConnMaxIdleTime: Duration(5 * time.Minute),
+			QueryTimeout:    Duration(5 * time.Second),
+			AutoMigrate:     true,
+		},
+		JWT: JWTConfig{Issuer: "rest-api"},
+	}
+}
+
+// setting binds one option to its environment variable and flag.
+type setting struct {
+	env, flag, usage string
+	set              func(*Config, string) error
+}
+
+var settings = []setting{
+	{"ADDR", "addr", "listen address", str(func(c *Config) *string { return &c.Addr })},
+	{"DB_DRIVER", "db-driver", "database/sql driver name", str(func(c *Config) *string { return &c.DB.Driver })},
+	{"DB_DSN", "db-dsn", "data source name, overrides the DB_* parts", str(func(c *Config) *string { return &c.DB.DSN })},
+	{"DB_DSN_FILE", "db-dsn-file", "file holding the data source name", str(func(c *Config) *string { return &c.DB.DSNFile })},
+	{"DB_HOST", "db-host", "database host", str(func(c *Config) *string { return &c.DB.Host })},
+	{"DB_PORT", "db-port", "database port", integer(func(c *Config) *int { return &c.DB.Port })},
+	{"DB_USER", "db-user", "database user", str(func(c *Config) *string { return &c.DB.User })},
+	{"DB_PASSWORD", "db-password", "database password", str(func(c *Config) *string { return &c.DB.Password })},
+	{"DB_PASSWORD_FILE", "db-password-file", "file holding the database password", str(func(c *Config) *string { return &c.DB.PasswordFile })},
+	{"DB_NAME", "db-name", "database name", str(func(c *Config) *string { return &c.DB.Name })},
+	{"DB_SSLMODE", "db-sslmode", "Postgres sslmode", str(func(c *Config) *string { return &c.DB.SSLMode })},
+	{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open connections, 0 for no limit", integer(func(c *Config) *int { return &c.DB.MaxOpenConns })},
+	{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle connections", integer(func(c *Config) *int { return &c.DB.MaxIdleConns })},
+	{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum connection lifetime", duration(func(c *Config) *Duration { return &c.DB.ConnMaxLifetime })},
+	{"DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "maximum connection idle time", duration(func(c *Config) *Duration { return &c.DB.ConnMaxIdleTime })},
+	{"DB_QUERY_TIMEOUT", "db-query-timeout", "maximum duration of a query", duration(func(c *Config) *Duration { return &c.DB.QueryTimeout })},
+	{"DB_AUTO_MIGRATE", "db-auto-migrate", "apply pending migrations on startup", boolean(func(c *Config) *bool { return &c.DB.AutoMigrate })},
+	{"JWT_ISSUER", "jwt-issuer", "expected token issuer", str(func(c *Config) *string { return &c.JWT.Issuer })},
+	{"JWT_SECRET", "jwt-secret", "HS256 secret", str(func(c *Config) *string { return &c.JWT.Secret })},
+	{"JWT_SECRET_FILE", "jwt-secret-file", "file holding the HS256 secret", str(func(c *Config) *string { return &c.JWT.SecretFile })},
+	{"JWT_PUBLIC_KEY_FILE", "jwt-public-key-file", "PEM encoded RS256 public key", str(func(c *Config) *string { return &c.JWT.PublicKeyFile })},
+	{"JWT_KEY_ID", "jwt-key-id", "kid of the RS256 key", str(func(c *Config) *string { return &c.JWT.KeyID })},
+	{"JWT_ISSUE_TOKENS", "jwt-issue-tokens", "serve POST /auth/token, for local development only", boolean(func(c *Config) *bool { return &c.JWT.IssueTokens })},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "maximum wait for in-flight requests on shutdown", duration(func(c *Config) *Duration { return &c.ShutdownTimeout })},
+	{"DRAIN_DELAY", "drain-delay", "time to fail readiness before shutting down", duration(func(c *Config) *Duration { return &c.DrainDelay })},
+	{"OUTBOX_WEBHOOK_URL", "outbox-webhook-url", "URL the domain events are posted to", str(func(c *Config) *string { return &c.OutboxWebhookURL })},
+	{"TRUSTED_PROXIES", "trusted-proxies", "comma separated proxy addresses or CIDRs trusted for X-Forwarded-For", list(func(c *Config) *[]string { return &c.TrustedProxies })},
+	{"TRACE_STDOUT", "trace-stdout", "print trace spans on stdout", boolean(func(c *Config) *bool { return &c.TraceStdout })},
+}
+
+func str(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func list(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*field(c) = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field(c) = append(*field(c), item)
+			}
+		}
+		return nil
+	}
+}
+
+func integer(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func boolean(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func duration(field func(*Config) *Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		return field(c).UnmarshalText([]byte(v))
+	}
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and args (usually os.Args[1:]), then validates it.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("rest-api", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+	flags := map[string]*string{}
+	for _, s := range settings {
+		flags[s.flag] = fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *file != "" {
+		if err := cfg.readFile(*file); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(&cfg, v); err != nil {
+				return Config{}, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if e := s.set(&cfg, *flags[s.flag]); e != nil {
+					err = fmt.Errorf("config: -%s: %w", s.flag, e)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg.Args = fs.Args()
+
+	if err := cfg.readSecrets(); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("config: unsupported file type %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// readSecrets replaces secrets by the content of their *_FILE, as mounted
+// by Docker or Kubernetes secrets.
+func (c *Config) readSecrets() error {
+	for _, s := range []struct{ file, value *string }{
+		{&c.DB.DSNFile, &c.DB.DSN},
+		{&c.DB.PasswordFile, &c.DB.Password},
+		{&c.JWT.SecretFile, &c.JWT.Secret},
+	} {
+		if *s.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(*s.file)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		*s.value = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if c.ShutdownTimeout < 0 || c.DrainDelay < 0 {
+		errs = append(errs, errors.New("shutdown_timeout and drain_delay must not be negative"))
+	}
+	if !slices.Contains(sql.Drivers(), c.DB.Driver) {
+		errs = append(errs, fmt.Errorf("db.driver %q is not registered", c.DB.Driver))
+	}
+	if c.DB.DSN == "" && (c.DB.Host == "" || c.DB.Name == "") {
+		errs = append(errs, errors.New("db.dsn or db.host and db.name are required"))
+	}
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("db connection limits must not be negative"))
+	}
+	if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		errs = append(errs, errors.New("db.max_idle_conns must not exceed db.max_open_conns"))
+	}
+	if c.DB.ConnMaxLifetime < 0 || c.DB.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("db connection lifetimes must not be negative"))
+	}
+	if c.DB.QueryTimeout <= 0 {
+		errs = append(errs, errors.New("db.query_timeout must be positive"))
+	}
+	// Subcommands such as migrate do not serve, so they need no keys.
+	if len(c.Args) == 0 && c.JWT.Secret == "" && c.JWT.PublicKeyFile == "" {
+		errs = append(errs, errors.New("jwt.secret or jwt.public_key_file is required"))
+	}
+	if c.JWT.IssueTokens && c.JWT.Secret == "" {
+		errs = append(errs, errors.New("jwt.issue_tokens requires jwt.secret"))
+	}
+	for _, p := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			errs = append(errs, fmt.Errorf("trusted_proxies: %q is no IP address or CIDR", p))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// DataSourceName returns DSN, or builds a Postgres DSN from its parts.
+func (c DBConfig) DataSourceName() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+	parts := []string{"host=" + quoteDSN(c.Host)}
+	if c.Port != 0 {
+		parts = append(parts, "port="+strconv.Itoa(c.Port))
+	}
+	if c.User != "" {
+		parts = append(parts, "user="+quoteDSN(c.User))
+	}
+	if c.Password != "" {
+		parts = append(parts, "password="+quoteDSN(c.Password))
+	}
+	parts = append(parts, "dbname="+quoteDSN(c.Name))
+	if c.SSLMode != "" {
+		parts = append(parts, "sslmode="+quoteDSN(c.SSLMode))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSN quotes a keyword/value DSN value when it needs it.
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
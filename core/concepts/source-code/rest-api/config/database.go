@@ -1,16 +1,21 @@
 package config
 
 import (
-	"log"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
-func InitDB() *sqlx.DB {
-	db, err := sqlx.Connect("postgres", "user=postgres password=postgres dbname=testdb sslmode=disable")
+// InitDB connects to the configured database and applies the pool settings.
+func InitDB(cfg DBConfig) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(cfg.Driver, cfg.DataSourceName())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return db
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime))
+	return db, nil
 }
@@ -0,0 +1,71 @@
+package crud
+
+import (
+	"context"
+
+	"rest-api/apperr"
+	"rest-api/repository"
+	"rest-api/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+func init() {
+	binding.Validator = validation.Default
+}
+
+// Bind decodes the JSON body into obj and validates it, recording a
+// Validation error for invalid fields and a BadRequest for a malformed body.
+// unique, when set, checks the fields tagged unique once the others pass.
+func Bind(c *gin.Context, obj any, unique validation.UniqueFunc) bool {
+	lang := validation.Language(c.GetHeader("Accept-Language"))
+	err := c.ShouldBindJSON(obj)
+	if errs, ok := validation.Translate(err, lang); ok {
+		c.Error(apperr.Validation(errs))
+		return false
+	}
+	if err != nil {
+		c.Error(apperr.BadRequest("malformed request body: "+err.Error(), err))
+		return false
+	}
+	return checkUnique(c, obj, lang, unique)
+}
+
+// Validate checks obj, decoded by other means than Bind, the way Bind does.
+func Validate(c *gin.Context, obj any, unique validation.UniqueFunc) bool {
+	lang := validation.Language(c.GetHeader("Accept-Language"))
+	if errs, ok := validation.Translate(validation.Default.ValidateStruct(obj), lang); ok {
+		c.Error(apperr.Validation(errs))
+		return false
+	}
+	return checkUnique(c, obj, lang, unique)
+}
+
+func checkUnique(c *gin.Context, obj any, lang string, unique validation.UniqueFunc) bool {
+	if unique == nil {
+		return true
+	}
+	errs, err := validation.CheckUnique(c.Request.Context(), obj, lang, unique)
+	if err != nil {
+		c.Error(err)
+		return false
+	}
+	if len(errs) > 0 {
+		c.Error(apperr.Validation(errs))
+		return false
+	}
+	return true
+}
+
+// UniqueIn checks unique fields against the live rows of repo, leaving out
+// the row being updated (id is nil on create).
+func UniqueIn[T any](repo repository.Repository[T], id any) validation.UniqueFunc {
+	return func(ctx context.Context, column string, value any) (bool, error) {
+		filters := []repository.Filter{{Field: column, Op: repository.OpEq, Value: value}}
+		if id != nil {
+			filters = append(filters, repository.Filter{Field: "id", Op: repository.OpNe, Value: id})
+		}
+		return repo.Exists(ctx, filters...)
+	}
+}
@@ -0,0 +1,266 @@
+// Package crud mounts the list/get/create/update/patch/delete routes of a
+// resource on top of a repository.Repository.
+package crud
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"rest-api/apperr"
+	"rest-api/middleware"
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware lists extra handlers run before each route, e.g. auth guards.
+type Middleware struct {
+	List, Get, Create, Update, Patch, Delete []gin.HandlerFunc
+}
+
+// Hooks are called around writes. An error returned by a hook stops the
+// request and is rendered like any other.
+type Hooks[T any] struct {
+	// BeforeList may narrow the query, e.g. to the rows of the caller.
+	BeforeList   func(c *gin.Context, q *repository.Query) error
+	BeforeCreate func(c *gin.Context, entity *T) error
+	AfterCreate  func(c *gin.Context, entity *T) error
+	// BeforeUpdate also runs for PATCH, on the patched entity.
+	BeforeUpdate func(c *gin.Context, id any, entity *T) error
+	AfterUpdate  func(c *gin.Context, entity *T) error
+	BeforeDelete func(c *gin.Context, id any) error
+	AfterDelete  func(c *gin.Context, id any) error
+}
+
+type Options[T any] struct {
+	// Name is used in error messages, e.g. "product".
+	Name string
+	// Filters and Sorts whitelist the columns of list queries.
+	Filters, Sorts []string
+	// ParseID turns the :id path parameter into a primary key. It defaults
+	// to integer ids.
+	ParseID    func(string) (any, error)
+	Middleware Middleware
+	// Redact, when set, clears the fields of an entity that must not be
+	// returned, e.g. secrets, before it is rendered.
+	Redact func(entity *T)
+	// RateLimited documents the 429 of routes guarded by a ratelimit policy.
+	RateLimited bool
+	Hooks       Hooks[T]
+}
+
+type resource[T any] struct {
+	repo repository.Repository[T]
+	opts Options[T]
+}
+
+// Register mounts on group:
+//
+//	GET    /      list, with filter[...], sort, cursor and size
+//	GET    /:id   get, with an ETag when T is versioned
+//	POST   /      create
+//	PUT    /:id   replace
+//	PATCH  /:id   partial update, see Patch
+//	DELETE /:id   delete
+//
+// Updates of versioned models require an If-Match header.
+func Register[T any](group *gin.RouterGroup, repo repository.Repository[T], opts Options[T]) {
+	r := newResource(repo, opts)
+	mw := opts.Middleware
+	group.GET("", chain(mw.List, r.list)...)
+	group.GET("/:id", chain(mw.Get, r.get)...)
+	group.POST("", chain(mw.Create, r.create)...)
+	group.PUT("/:id", chain(mw.Update, r.update)...)
+	group.PATCH("/:id", chain(mw.Patch, r.patch)...)
+	group.DELETE("/:id", chain(mw.Delete, r.delete)...)
+}
+
+func newResource[T any](repo repository.Repository[T], opts Options[T]) *resource[T] {
+	if opts.Name == "" {
+		opts.Name = "resource"
+	}
+	if opts.ParseID == nil {
+		opts.ParseID = func(s string) (any, error) { return strconv.Atoi(s) }
+	}
+	return &resource[T]{repo: repo, opts: opts}
+}
+
+// chain copies mw so that routes sharing a middleware slice never write to
+// the same backing array.
+func chain(mw []gin.HandlerFunc, h gin.HandlerFunc) []gin.HandlerFunc {
+	return append(append([]gin.HandlerFunc{}, mw...), h)
+}
+
+func (r *resource[T]) id(c *gin.Context) (any, bool) {
+	id, err := r.opts.ParseID(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.NotFound(r.opts.Name+" not found", err))
+		return nil, false
+	}
+	return id, true
+}
+
+func (r *resource[T]) list(c *gin.Context) {
+	q, err := ParseListQuery(c.Request.URL.Query(), r.opts.Filters, r.opts.Sorts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	q.IncludeDeleted = c.Query("include_deleted") == "true" && middleware.IsAdmin(c)
+	if hook := r.opts.Hooks.BeforeList; hook != nil {
+		if err := hook(c, &q); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	page, err := r.repo.List(c.Request.Context(), q)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	for i := range page.Data {
+		r.redact(&page.Data[i])
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func (r *resource[T]) get(c *gin.Context) {
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+	entity, err := r.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if version, ok := repository.Version(entity); ok {
+		c.Header("ETag", ETag(version))
+	}
+	r.redact(entity)
+	c.JSON(http.StatusOK, entity)
+}
+
+func (r *resource[T]) redact(entity *T) {
+	if r.opts.Redact != nil {
+		r.opts.Redact(entity)
+	}
+}
+
+func (r *resource[T]) create(c *gin.Context) {
+	var entity T
+	if !Bind(c, &entity, UniqueIn(r.repo, nil)) {
+		return
+	}
+	if !r.hook(c, r.opts.Hooks.BeforeCreate, &entity) {
+		return
+	}
+	if err := r.repo.Create(c.Request.Context(), &entity); err != nil {
+		c.Error(err)
+		return
+	}
+	if !r.hook(c, r.opts.Hooks.AfterCreate, &entity) {
+		return
+	}
+	r.redact(&entity)
+	c.JSON(http.StatusCreated, entity)
+}
+
+// ifMatch returns the version a write of a versioned T with primary key id
+// expects, see IfMatch.
+func (r *resource[T]) ifMatch(c *gin.Context, id any) (version int, ok bool) {
+	if _, versioned := repository.Version(new(T)); !versioned {
+		return 0, true
+	}
+	return IfMatch(c, r.opts.Name, func() (int, error) {
+		entity, err := r.repo.GetByID(c.Request.Context(), id)
+		if err != nil {
+			return 0, err
+		}
+		version, _ := repository.Version(entity)
+		return version, nil
+	})
+}
+
+// modified turns a version conflict into the 412 of a stale If-Match.
+func (r *resource[T]) modified(err error) error {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return apperr.PreconditionFailed("the "+r.opts.Name+" has been modified", err)
+	}
+	return err
+}
+
+// update replaces the entity with the body.
+func (r *resource[T]) update(c *gin.Context) {
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+	version, ok := r.ifMatch(c, id)
+	if !ok {
+		return
+	}
+	var entity T
+	if !Bind(c, &entity, UniqueIn(r.repo, id)) {
+		return
+	}
+	repository.SetVersion(&entity, version)
+	if hook := r.opts.Hooks.BeforeUpdate; hook != nil {
+		if err := hook(c, id, &entity); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := r.repo.Update(c.Request.Context(), id, &entity); err != nil {
+		c.Error(r.modified(err))
+		return
+	}
+	r.updated(c, &entity)
+}
+
+func (r *resource[T]) updated(c *gin.Context, entity *T) {
+	if !r.hook(c, r.opts.Hooks.AfterUpdate, entity) {
+		return
+	}
+	if version, ok := repository.Version(entity); ok {
+		c.Header("ETag", ETag(version))
+	}
+	r.redact(entity)
+	c.JSON(http.StatusOK, entity)
+}
+
+func (r *resource[T]) delete(c *gin.Context) {
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+	if hook := r.opts.Hooks.BeforeDelete; hook != nil {
+		if err := hook(c, id); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	if err := r.repo.Delete(c.Request.Context(), id); err != nil {
+		c.Error(err)
+		return
+	}
+	if hook := r.opts.Hooks.AfterDelete; hook != nil {
+		if err := hook(c, id); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func (r *resource[T]) hook(c *gin.Context, hook func(*gin.Context, *T) error, entity *T) bool {
+	if hook == nil {
+		return true
+	}
+	if err := hook(c, entity); err != nil {
+		c.Error(err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package crud
+
+import (
+	"strconv"
+	"strings"
+
+	"rest-api/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag renders an entity version as a strong ETag.
+func ETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ParseETag reads the version back from an If-Match header. Weak tags are
+// accepted since versions are exact anyway.
+func ParseETag(header string) (int, bool) {
+	tag := strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.Atoi(unquoted)
+	return version, err == nil
+}
+
+// AnyETag is the If-Match value that matches any current representation.
+const AnyETag = "*"
+
+// IfMatch returns the version the If-Match header of a write expects, or
+// answers PreconditionRequired without the header and PreconditionFailed for
+// a malformed one. "*" matches whatever version current loads, so only a
+// missing entity fails it, with the error of current.
+func IfMatch(c *gin.Context, name string, current func() (int, error)) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch header {
+	case "":
+		c.Error(apperr.PreconditionRequired("the If-Match header is required"))
+		return 0, false
+	case AnyETag:
+		version, err := current()
+		if err != nil {
+			c.Error(err)
+			return 0, false
+		}
+		return version, true
+	}
+	version, ok := ParseETag(header)
+	if !ok {
+		c.Error(apperr.PreconditionFailed("If-Match does not match the "+name, nil))
+	}
+	return version, ok
+}
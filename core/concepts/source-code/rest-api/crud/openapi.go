@@ -0,0 +1,49 @@
+package crud
+
+import (
+	"net/http"
+
+	"rest-api/openapi"
+	"rest-api/repository"
+)
+
+// Auth gives the requirements of each route mounted by Register, mirroring
+// the guards of Options.Middleware.
+type Auth struct {
+	List, Get, Create, Update, Patch, Delete openapi.Auth
+}
+
+// Describe documents in spec the routes Register mounts on path.
+func Describe[T any](spec *openapi.Spec, path string, opts Options[T], auth Auth) {
+	var entity T
+	tags := []string{opts.Name + "s"}
+	_, versioned := repository.Version(&entity)
+	add := func(method, path string, op openapi.Op) {
+		op.RateLimited = opts.RateLimited
+		spec.Add(method, path, op)
+	}
+	add(http.MethodGet, path, openapi.Op{
+		Summary: "List " + opts.Name + "s", Tags: tags, Auth: auth.List,
+		Params: openapi.ListParams(opts.Filters, opts.Sorts), Response: repository.Page[T]{},
+		Errors: []int{http.StatusBadRequest},
+	})
+	add(http.MethodGet, path+"/:id", openapi.Op{
+		Summary: "Get a " + opts.Name, Tags: tags, Auth: auth.Get, Response: entity, ETag: versioned,
+	})
+	add(http.MethodPost, path, openapi.Op{
+		Summary: "Create a " + opts.Name, Tags: tags, Auth: auth.Create,
+		Request: entity, Response: entity, Status: http.StatusCreated, Errors: []int{http.StatusConflict},
+	})
+	add(http.MethodPut, path+"/:id", openapi.Op{
+		Summary: "Replace a " + opts.Name, Tags: tags, Auth: auth.Update,
+		Request: entity, Response: entity, ETag: versioned, IfMatch: versioned,
+	})
+	add(http.MethodPatch, path+"/:id", openapi.Op{
+		Summary: "Update fields of a " + opts.Name, Tags: tags, Auth: auth.Patch,
+		Request: entity, RequestTypes: PatchTypes, Response: entity, ETag: versioned, IfMatch: versioned,
+		Errors: []int{http.StatusConflict, http.StatusUnsupportedMediaType},
+	})
+	add(http.MethodDelete, path+"/:id", openapi.Op{
+		Summary: "Delete a " + opts.Name, Tags: tags, Auth: auth.Delete, Response: openapi.Status{},
+	})
+}
@@ -0,0 +1,126 @@
+package crud
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+
+	"rest-api/apperr"
+	"rest-api/repository"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+)
+
+// Media types accepted by PATCH routes. Plain application/json is read as a
+// merge patch.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// PatchTypes lists the documented media types of PATCH bodies.
+var PatchTypes = []string{MergePatchType, JSONPatchType}
+
+// Patch returns the handler of PATCH /:id, for routes not mounted with
+// Register. The body is applied to the JSON of the stored entity, either as
+// an RFC 7396 merge patch or as an RFC 6902 JSON Patch depending on its
+// Content-Type. The result is validated like a full body, and only the
+// columns it changes are written.
+func Patch[T any](repo repository.Repository[T], opts Options[T]) gin.HandlerFunc {
+	return newResource(repo, opts).patch
+}
+
+func (r *resource[T]) patch(c *gin.Context) {
+	id, ok := r.id(c)
+	if !ok {
+		return
+	}
+	version, ok := r.ifMatch(c, id)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Error(apperr.BadRequest("could not read the request body", err))
+		return
+	}
+	current, err := r.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	doc, err = applyPatch(c.ContentType(), doc, body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	var entity T
+	if err := json.Unmarshal(doc, &entity); err != nil {
+		c.Error(apperr.BadRequest("the patched "+r.opts.Name+" is malformed: "+err.Error(), err))
+		return
+	}
+	keepHidden(current, &entity)
+	if !Validate(c, &entity, UniqueIn(r.repo, id)) {
+		return
+	}
+	if hook := r.opts.Hooks.BeforeUpdate; hook != nil {
+		if err := hook(c, id, &entity); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	fields := repository.Changes(current, &entity)
+	if _, versioned := repository.Version(current); versioned {
+		fields["version"] = version
+	}
+	updated, err := r.repo.UpdateFields(c.Request.Context(), id, fields)
+	if err != nil {
+		c.Error(r.modified(err))
+		return
+	}
+	r.updated(c, updated)
+}
+
+func applyPatch(contentType string, doc, patch []byte) ([]byte, error) {
+	switch contentType {
+	case MergePatchType, "application/json":
+		out, err := jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return nil, apperr.BadRequest("malformed merge patch: "+err.Error(), err)
+		}
+		return out, nil
+	case JSONPatchType:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, apperr.BadRequest("malformed JSON Patch: "+err.Error(), err)
+		}
+		out, err := ops.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, apperr.Conflict(err.Error(), err)
+		}
+		if err != nil {
+			return nil, apperr.BadRequest("the JSON Patch cannot be applied: "+err.Error(), err)
+		}
+		return out, nil
+	}
+	return nil, apperr.UnsupportedMediaType("PATCH accepts " + MergePatchType + " and " + JSONPatchType)
+}
+
+// keepHidden copies the fields that are not serialized, such as secrets,
+// from current to patched: the patch cannot see them, so it cannot change
+// them.
+func keepHidden[T any](current, patched *T) {
+	src, dst := reflect.ValueOf(current).Elem(), reflect.ValueOf(patched).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if f := src.Type().Field(i); f.IsExported() && f.Tag.Get("json") == "-" {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package crud
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rest-api/apperr"
+	"rest-api/repository"
+)
+
+// filterParam matches filter[field] and filter[field][op].
+var filterParam = regexp.MustCompile(`^filter\[(\w+)\](?:\[(\w+)\])?$`)
+
+// offsetParams are the paging parameters of offset pagination, which list
+// routes do not take: they page with cursor and size.
+var offsetParams = []string{"page", "per_page", "page_size", "limit", "offset", "skip"}
+
+// ParseListQuery turns ?filter[name]=...&sort=-id&cursor=...&size=... into a
+// repository.Query. It answers BadRequest for offset paging parameters, a
+// size that is not a positive integer and repeated parameters, which would
+// otherwise be ignored. Unknown fields are rejected later by the repository.
+func ParseListQuery(values url.Values, allowedFilters, allowedSorts []string) (repository.Query, error) {
+	q := repository.Query{
+		AllowedFilters: allowedFilters,
+		AllowedSorts:   allowedSorts,
+	}
+	for _, key := range offsetParams {
+		if values.Has(key) {
+			return q, invalidQuery("%s is not supported, page with cursor and size", key)
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key, vals := range values {
+		if len(vals) > 1 {
+			return q, invalidQuery("%s is repeated", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	q.Cursor = values.Get("cursor")
+	if size := values.Get("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			return q, invalidQuery("size must be a positive integer")
+		}
+		q.Limit = n
+	}
+
+	for _, key := range keys {
+		m := filterParam.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		op := repository.Op(m[2])
+		if op == "" {
+			op = repository.OpEq
+		}
+		var value any = values.Get(key)
+		if op == repository.OpIn {
+			value = strings.Split(values.Get(key), ",")
+		}
+		q.Filters = append(q.Filters, repository.Filter{Field: m[1], Op: op, Value: value})
+	}
+
+	for _, field := range strings.Split(values.Get("sort"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		s := repository.Sort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		q.Sorts = append(q.Sorts, s)
+	}
+	return q, nil
+}
+
+func invalidQuery(format string, args ...any) error {
+	err := fmt.Errorf("%w: "+format, append([]any{repository.ErrInvalidQuery}, args...)...)
+	return apperr.BadRequest(err.Error(), err)
+}
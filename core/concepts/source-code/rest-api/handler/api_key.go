@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rest-api/apperr"
+	"rest-api/auth"
+	"rest-api/crud"
+	"rest-api/model"
+	"rest-api/repository"
+	"rest-api/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/jmoiron/sqlx"
+)
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,scope"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func init() {
+	err := validation.RegisterRule("scope", func(fl validator.FieldLevel) bool {
+		return auth.ValidScopes([]string{fl.Field().String()}) == nil
+	}, map[string]string{
+		"en": "{0} must be a known scope",
+		"fr": "{0} doit être un scope connu",
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// APIKeyResponse carries the plain key, which is never shown again.
+type APIKeyResponse struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+func apiKeys(db *sqlx.DB) repository.SQLRepository[model.APIKey] {
+	return repository.SQLRepository[model.APIKey]{DB: db, Table: "api_keys"}
+}
+
+func CreateAPIKey(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req APIKeyRequest
+		if !crud.Bind(c, &req, nil) {
+			return
+		}
+		plain, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		key := model.APIKey{Name: req.Name, Prefix: prefix, Hash: hash, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt}
+		repo := apiKeys(db)
+		if err := repo.Create(c.Request.Context(), &key); err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusCreated, APIKeyResponse{APIKey: key, Key: plain})
+	}
+}
+
+func ListAPIKeys(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := crud.ParseListQuery(c.Request.URL.Query(), []string{"name", "prefix"}, []string{"id", "name", "created_at"})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		repo := apiKeys(db)
+		page, err := repo.List(c.Request.Context(), q)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// RotateAPIKey replaces the secret of a key, keeping its name and scopes.
+func RotateAPIKey(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		plain, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		repo := apiKeys(db)
+		key, err := repo.UpdateFieldsWhere(c.Request.Context(), id, map[string]any{"prefix": prefix, "hash": hash}, auth.LiveAPIKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperr.NotFound(fmt.Sprintf("api key %d not found or revoked", id), err)
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, APIKeyResponse{APIKey: *key, Key: plain})
+	}
+}
+
+// RevokeAPIKey is idempotent: revoking a revoked key keeps its revoked_at.
+func RevokeAPIKey(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		repo := apiKeys(db)
+		key, err := repo.UpdateFieldsWhere(c.Request.Context(), id, map[string]any{"revoked_at": time.Now().UTC()}, auth.LiveAPIKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already revoked, or missing.
+			key, err = repo.GetByID(c.Request.Context(), id)
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, key)
+	}
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"rest-api/auth"
+	"rest-api/crud"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenRequest struct {
+	Subject string   `json:"subject" binding:"required"`
+	Roles   []string `json:"roles"`
+}
+
+type TokenResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// IssueToken signs a token for any subject and roles. It is meant for local
+// development only.
+func IssueToken(issuer auth.Issuer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req TokenRequest
+		if !crud.Bind(c, &req, nil) {
+			return
+		}
+		token, expires, err := issuer.Issue(req.Subject, req.Roles)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, TokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresAt: expires})
+	}
+}
@@ -1,9 +1,17 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"rest-api/apperr"
+	"rest-api/crud"
+	"rest-api/middleware"
 	"rest-api/model"
 	"rest-api/repository"
 
@@ -11,17 +19,64 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// UserFilters and UserSorts are the columns GET /users filters and sorts on.
+var (
+	UserFilters = []string{"id", "name", "email"}
+	UserSorts   = []string{"id", "name", "email", "created_at", "updated_at"}
+)
+
+// userCaches holds the users repository of each database, so that the
+// handlers share its cache and their writes evict it.
+var userCaches sync.Map
+
+// Users returns the repository of users of db, with GetByID cached for 30
+// seconds. Its writes record events in the outbox.
+func Users(db *sqlx.DB) *repository.CachedRepository[model.User] {
+	if repo, ok := userCaches.Load(db); ok {
+		return repo.(*repository.CachedRepository[model.User])
+	}
+	repo, _ := userCaches.LoadOrStore(db, repository.NewCachedRepository(
+		&repository.SQLRepository[model.User]{DB: db, Table: "users", Outbox: &repository.Outbox{}}, 1024, 30*time.Second))
+	return repo.(*repository.CachedRepository[model.User])
+}
+
+// UserSearch searches the names and emails of users with the full-text
+// search of PostgreSQL.
+func UserSearch(db *sqlx.DB) repository.Searcher[model.User] {
+	return repository.PostgresSearch[model.User]{Repo: Users(db).SQLRepository, Columns: []string{"name", "email"}}
+}
+
+// MaxSearchLength bounds the text of GET /users/search.
+const MaxSearchLength = 200
+
+// SearchUsers answers GET /users/search?q=, with the size and cursor of list
+// routes.
+func SearchUsers(s repository.Searcher[model.User]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text := strings.TrimSpace(c.Query("q"))
+		if text == "" || len(text) > MaxSearchLength {
+			c.Error(apperr.BadRequest(fmt.Sprintf("q must hold 1 to %d characters", MaxSearchLength), nil))
+			return
+		}
+		size, _ := strconv.Atoi(c.Query("size"))
+		page, err := s.Search(c.Request.Context(), repository.SearchQuery{Text: text, Limit: size, Cursor: c.Query("cursor")})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
 func CreateUser(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		repo := Users(db)
 		var user model.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !crud.Bind(c, &user, crud.UniqueIn[model.User](repo, nil)) {
 			return
 		}
-		repo := repository.SQLRepository[model.User]{DB: db, Table: "users"}
-		err := repo.Create(&user)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := repo.Create(c.Request.Context(), &user); err != nil {
+			c.Error(err)
 			return
 		}
 		c.JSON(http.StatusCreated, user)
@@ -30,28 +85,32 @@ func CreateUser(db *sqlx.DB) gin.HandlerFunc {
 
 func GetUsers(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
-		offset := (page - 1) * size
-		repo := repository.SQLRepository[model.User]{DB: db, Table: "users"}
-		users, err := repo.ListPaginated(size, offset)
+		q, err := crud.ParseListQuery(c.Request.URL.Query(), UserFilters, UserSorts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Error(err)
 			return
 		}
-		c.JSON(http.StatusOK, users)
+		q.IncludeDeleted = c.Query("include_deleted") == "true" && middleware.IsAdmin(c)
+		repo := Users(db)
+		page, err := repo.List(c.Request.Context(), q)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, page)
 	}
 }
 
 func GetUserByID(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
-		repo := repository.SQLRepository[model.User]{DB: db, Table: "users"}
-		user, err := repo.GetByID(id)
+		repo := Users(db)
+		user, err := repo.GetByID(c.Request.Context(), id)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			c.Error(err)
 			return
 		}
+		c.Header("ETag", crud.ETag(user.Version))
 		c.JSON(http.StatusOK, user)
 	}
 }
@@ -59,30 +118,61 @@ func GetUserByID(db *sqlx.DB) gin.HandlerFunc {
 func UpdateUser(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
+		repo := Users(db)
+		version, ok := crud.IfMatch(c, "user", func() (int, error) {
+			current, err := repo.GetByID(c.Request.Context(), id)
+			if err != nil {
+				return 0, err
+			}
+			return current.Version, nil
+		})
+		if !ok {
+			return
+		}
 		var user model.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if !crud.Bind(c, &user, crud.UniqueIn[model.User](repo, id)) {
 			return
 		}
-		repo := repository.SQLRepository[model.User]{DB: db, Table: "users"}
-		err := repo.Update(id, &user)
+		user.Version = version
+		err := repo.Update(c.Request.Context(), id, &user)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			err = apperr.PreconditionFailed("the user has been modified", err)
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Error(err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "updated"})
+		c.Header("ETag", crud.ETag(user.Version))
+		c.JSON(http.StatusOK, user)
 	}
 }
 
+// PatchUser updates the fields named by a merge patch or a JSON Patch; see
+// crud.Patch.
+func PatchUser(db *sqlx.DB) gin.HandlerFunc {
+	return crud.Patch[model.User](Users(db), crud.Options[model.User]{Name: "user"})
+}
+
 func DeleteUser(db *sqlx.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, _ := strconv.Atoi(c.Param("id"))
-		repo := repository.SQLRepository[model.User]{DB: db, Table: "users"}
-		err := repo.Delete(id)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		repo := Users(db)
+		if err := repo.Delete(c.Request.Context(), id); err != nil {
+			c.Error(err)
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 	}
 }
+
+func RestoreUser(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		repo := Users(db)
+		if err := repo.Restore(c.Request.Context(), id); err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "restored"})
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"rest-api/apperr"
+	"rest-api/bulk"
+	"rest-api/crud"
+	"rest-api/model"
+	"rest-api/repository"
+	"rest-api/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// ImportBatchSize is the number of rows ImportUsers inserts per savepoint,
+// and ExportPageSize the number of users ExportUsers reads per query.
+const (
+	ImportBatchSize = 500
+	ExportPageSize  = repository.MaxLimit
+)
+
+// MaxImportErrors bounds the rejected rows listed by an ImportReport; the
+// others are only counted.
+const MaxImportErrors = 1000
+
+// MaxImportBytes bounds the body of an import, which is read in a single
+// write transaction.
+const MaxImportBytes = 32 << 20
+
+// importIgnored are the columns of an export that an import does not read:
+// the database sets them.
+var importIgnored = []string{"id", "created_at", "updated_at", "deleted_at", "version"}
+
+// ImportReport is the outcome of POST /users:import.
+type ImportReport struct {
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportError is a rejected row, with the line it starts on.
+type ImportError struct {
+	Line   int               `json:"line"`
+	Detail string            `json:"detail"`
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+type importRow struct {
+	line int
+	user model.User
+}
+
+type userImport struct {
+	repo   *repository.SQLRepository[model.User]
+	lang   string
+	report ImportReport
+}
+
+// ImportUsers creates the users of a CSV or NDJSON body of up to
+// MaxImportBytes. Rows are validated like POST /users, without the columns
+// set by the database; rejected rows are reported and the others imported,
+// all in one transaction, so that nothing is imported when the request
+// fails.
+func ImportUsers(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, ok := bulk.ContentType(c.GetHeader("Content-Type"))
+		if !ok {
+			c.Error(apperr.UnsupportedMediaType("imports accept " + strings.Join(bulk.Formats, " and ")))
+			return
+		}
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportBytes)
+		rows, err := bulk.NewReader[model.User](body, format, importIgnored...)
+		if err != nil {
+			c.Error(bodyError(err))
+			return
+		}
+		imp := &userImport{
+			repo:   Users(db).SQLRepository,
+			lang:   validation.Language(c.GetHeader("Accept-Language")),
+			report: ImportReport{Errors: []ImportError{}},
+		}
+		ctx := c.Request.Context()
+		err = repository.UnitOfWork{DB: db}.WithTx(ctx, func(tx *repository.Tx) error {
+			batch := make([]importRow, 0, ImportBatchSize)
+			for {
+				var user model.User
+				line, err := rows.Read(&user)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				var rowErr *bulk.RowError
+				if errors.As(err, &rowErr) {
+					imp.fail(line, apperr.BadRequest("malformed row: "+rowErr.Err.Error(), err))
+					continue
+				}
+				if err != nil {
+					return bodyError(err)
+				}
+				if errs, ok := validation.Translate(validation.Default.ValidateStruct(&user), imp.lang); ok {
+					imp.fail(line, apperr.Validation(errs))
+					continue
+				}
+				batch = append(batch, importRow{line: line, user: user})
+				if len(batch) == ImportBatchSize {
+					if err := imp.insert(ctx, tx, batch); err != nil {
+						return err
+					}
+					batch = batch[:0]
+				}
+			}
+			return imp.insert(ctx, tx, batch)
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, imp.report)
+	}
+}
+
+// bodyError is the error of an import body that cannot be read.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apperr.TooLarge(fmt.Sprintf("imports are limited to %d bytes", tooLarge.Limit), err)
+	}
+	return apperr.BadRequest("malformed request body: "+err.Error(), err)
+}
+
+// insert creates batch in a savepoint. When a row is rejected, the batch is
+// rolled back and redone row by row, to report that row and keep the others.
+func (imp *userImport) insert(ctx context.Context, tx *repository.Tx, batch []importRow) error {
+	err := tx.WithTx(ctx, func(tx *repository.Tx) error {
+		for i := range batch {
+			if err := imp.create(ctx, tx, &batch[i].user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		imp.report.Imported += len(batch)
+		return nil
+	}
+	if !rejected(err) {
+		return err
+	}
+	for i := range batch {
+		err := tx.WithTx(ctx, func(tx *repository.Tx) error {
+			return imp.create(ctx, tx, &batch[i].user)
+		})
+		switch {
+		case err == nil:
+			imp.report.Imported++
+		case rejected(err):
+			imp.fail(batch[i].line, err)
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// create checks the unique fields of user against the rows imported so far,
+// then inserts it.
+func (imp *userImport) create(ctx context.Context, tx *repository.Tx, user *model.User) error {
+	repo := imp.repo.InTx(tx)
+	errs, err := validation.CheckUnique(ctx, user, imp.lang, crud.UniqueIn[model.User](repo, nil))
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return apperr.Validation(errs)
+	}
+	return repo.Create(ctx, user)
+}
+
+// rejected reports whether err is about the row rather than the import.
+func rejected(err error) bool {
+	var e *apperr.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.Kind == apperr.KindValidation || e.Kind == apperr.KindConflict || e.Kind == apperr.KindBadRequest
+}
+
+func (imp *userImport) fail(line int, err error) {
+	imp.report.Failed++
+	if len(imp.report.Errors) == MaxImportErrors {
+		return
+	}
+	e := apperr.As(err)
+	imp.report.Errors = append(imp.report.Errors, ImportError{Line: line, Detail: e.Detail, Errors: e.Fields})
+}
+
+// ExportUsers streams the live users as CSV or NDJSON, after the format
+// query parameter, page by page. Pages follow keyset cursors, so that rows
+// written during the export shift no page. A failure after the first page
+// truncates the response.
+func ExportUsers(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.DefaultQuery("format", "csv")
+		format, ok := bulk.Format(name)
+		if !ok {
+			c.Error(apperr.BadRequest("format must be csv or ndjson", nil))
+			return
+		}
+		repo := Users(db)
+		var out *bulk.Writer[model.User]
+		q := repository.Query{Limit: ExportPageSize}
+		for {
+			page, err := repo.List(c.Request.Context(), q)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			if out == nil {
+				c.Header("Content-Type", format)
+				c.Header("Content-Disposition", `attachment; filename="users.`+name+`"`)
+				c.Status(http.StatusOK)
+				if out, err = bulk.NewWriter[model.User](c.Writer, format); err != nil {
+					c.Error(err)
+					return
+				}
+			}
+			for i := range page.Data {
+				if err := out.Write(&page.Data[i]); err != nil {
+					c.Error(err)
+					return
+				}
+			}
+			if err := out.Flush(); err != nil {
+				c.Error(err)
+				return
+			}
+			c.Writer.Flush()
+			if page.NextCursor == "" {
+				return
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+}
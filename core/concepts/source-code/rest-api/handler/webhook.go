@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rest-api/apperr"
+	"rest-api/crud"
+	"rest-api/middleware"
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// DeliveryFilters and DeliverySorts are the columns the delivery log filters
+// and sorts on.
+var (
+	DeliveryFilters = []string{"status", "event_type", "event_id"}
+	DeliverySorts   = []string{"id", "created_at", "next_attempt_at"}
+)
+
+// WebhookOptions are the crud options of /webhooks. Secrets are write-only.
+// Callers list and create their own webhooks; the routes of one webhook must
+// be guarded by OwnWebhook.
+var WebhookOptions = crud.Options[model.Webhook]{
+	Name:    "webhook",
+	Filters: []string{"url", "paused", "owner"},
+	Sorts:   []string{"id", "created_at"},
+	Redact:  func(w *model.Webhook) { w.Secret = "" },
+	Hooks: crud.Hooks[model.Webhook]{
+		BeforeList: func(c *gin.Context, q *repository.Query) error {
+			owner, all, err := webhookOwner(c)
+			if err == nil && !all {
+				q.Filters = append(q.Filters, repository.Filter{Field: "owner", Op: repository.OpEq, Value: owner})
+			}
+			return err
+		},
+		BeforeCreate: func(c *gin.Context, hook *model.Webhook) error {
+			owner, _, err := webhookOwner(c)
+			hook.Owner = owner
+			return err
+		},
+		BeforeUpdate: func(c *gin.Context, _ any, hook *model.Webhook) error {
+			stored, ok := c.Get(webhookKey)
+			if !ok {
+				return errors.New("handler: webhook updates must be guarded by OwnWebhook")
+			}
+			hook.Owner = stored.(*model.Webhook).Owner
+			return nil
+		},
+	},
+}
+
+// webhookKey stores the webhook loaded by OwnWebhook on the context.
+const webhookKey = "webhook"
+
+// webhookOwner returns the owner of the caller's webhooks, the subject of its
+// credentials, and whether it is an admin, which acts on every webhook.
+func webhookOwner(c *gin.Context) (owner string, all bool, err error) {
+	claims, ok := middleware.Claims(c)
+	if !ok || claims.Subject == "" {
+		return "", false, apperr.Forbidden("webhooks need credentials with a subject")
+	}
+	return claims.Subject, claims.HasRole("admin"), nil
+}
+
+// OwnWebhook answers NotFound unless the webhook of the :id path parameter
+// belongs to the caller, or the caller is an admin.
+func OwnWebhook(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := webhook(c, db); !ok {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func webhooks(db *sqlx.DB) *repository.SQLRepository[model.Webhook] {
+	return &repository.SQLRepository[model.Webhook]{DB: db, Table: "webhooks"}
+}
+
+func webhookDeliveries(db *sqlx.DB) *repository.SQLRepository[model.WebhookDelivery] {
+	return &repository.SQLRepository[model.WebhookDelivery]{DB: db, Table: "webhook_deliveries"}
+}
+
+// webhook loads the webhook of the :id path parameter, when the caller may
+// see it. Webhooks of others are NotFound, so that their ids do not leak.
+func webhook(c *gin.Context, db *sqlx.DB) (*model.Webhook, bool) {
+	owner, all, err := webhookOwner(c)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apperr.NotFound("webhook not found", err))
+		return nil, false
+	}
+	hook, err := webhooks(db).GetByID(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	if !all && hook.Owner != owner {
+		c.Error(apperr.NotFound(fmt.Sprintf("webhooks %d not found", id), nil))
+		return nil, false
+	}
+	c.Set(webhookKey, hook)
+	return hook, true
+}
+
+// ListWebhookDeliveries is the delivery log of a webhook.
+func ListWebhookDeliveries(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := webhook(c, db)
+		if !ok {
+			return
+		}
+		q, err := crud.ParseListQuery(c.Request.URL.Query(), DeliveryFilters, DeliverySorts)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		q.Filters = append(q.Filters, repository.Filter{Field: "webhook_id", Op: repository.OpEq, Value: hook.ID})
+		q.AllowedFilters = append(append([]string{}, DeliveryFilters...), "webhook_id")
+		page, err := webhookDeliveries(db).List(c.Request.Context(), q)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// RetryWebhookDelivery queues a dead delivery again, with fresh attempts.
+// The status is checked by the update itself, so that a concurrent retry or
+// the Deliverer cannot have a live delivery reset.
+func RetryWebhookDelivery(db *sqlx.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := webhook(c, db)
+		if !ok {
+			return
+		}
+		repo := webhookDeliveries(db)
+		id, _ := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+		delivery, err := repo.UpdateFieldsWhere(c.Request.Context(), id, map[string]any{
+			"status":          model.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC(),
+			"last_error":      "",
+		},
+			repository.Filter{Field: "webhook_id", Op: repository.OpEq, Value: hook.ID},
+			repository.Filter{Field: "status", Op: repository.OpEq, Value: model.DeliveryDead},
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = retryConflict(c, repo, hook.ID, id)
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// retryConflict tells a delivery of another webhook or none at all, which
+// is NotFound, from one that is not dead, which is a Conflict.
+func retryConflict(c *gin.Context, repo *repository.SQLRepository[model.WebhookDelivery], hookID int, id int64) error {
+	delivery, err := repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		return err
+	}
+	if delivery.WebhookID != hookID {
+		return apperr.NotFound("delivery not found", nil)
+	}
+	return apperr.Conflict("only dead deliveries can be retried", nil)
+}
@@ -4,25 +4,139 @@
 package main
 
 import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"rest-api/auth"
 	"rest-api/config"
 	"rest-api/handler"
-	"rest-api/middleware"
-
-	"github.com/gin-gonic/gin"
+	"rest-api/migrate"
+	"rest-api/migrations"
+	"rest-api/outbox"
+	"rest-api/repository"
+	"rest-api/router"
+	"rest-api/server"
+	"rest-api/telemetry"
+	"rest-api/webhook"
 )
 
 func main() {
-	db := config.InitDB()
-	r := gin.Default()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run returns instead of exiting so that the deferred cleanups, closing the
+// pool and flushing the traces, happen on shutdown.
+func run() error {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		return runMigrate(cfg.DB, cfg.Args[1:])
+	}
+	db, err := config.InitDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator := &migrate.Migrator{DB: db, FS: migrations.FS}
+	if cfg.DB.AutoMigrate {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			return err
+		}
+	}
 
-	r.GET("/users", handler.GetUsers(db))
-	r.GET("/users/:id", handler.GetUserByID(db))
+	var traces io.Writer
+	if cfg.TraceStdout {
+		traces = os.Stdout
+	}
+	shutdown, err := telemetry.Setup("rest-api", traces)
+	if err != nil {
+		return err
+	}
+	defer shutdown(context.Background())
+	repository.DefaultObserver = telemetry.Repository
+	if err := telemetry.RegisterDB(db.DB, "rest-api"); err != nil {
+		return err
+	}
+	if err := telemetry.RegisterCache("users", handler.Users(db).Stats); err != nil {
+		return err
+	}
 
-	auth := r.Group("/")
-	auth.Use(middleware.AuthMiddleware())
-	auth.POST("/users", handler.CreateUser(db))
-	auth.PUT("/users/:id", handler.UpdateUser(db))
-	auth.DELETE("/users/:id", handler.DeleteUser(db))
+	secret := []byte(cfg.JWT.Secret)
+	keys := auth.KeySet{Issuer: cfg.JWT.Issuer, Keys: map[string]any{}}
+	if len(secret) > 0 {
+		keys.Keys[""] = secret
+	}
+	if cfg.JWT.PublicKeyFile != "" {
+		key, err := auth.LoadRSAPublicKey(cfg.JWT.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		keys.Keys[cfg.JWT.KeyID] = key
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	queryTimeout := time.Duration(cfg.DB.QueryTimeout)
+
+	var sink outbox.Sink = outbox.LogSink{}
+	if cfg.OutboxWebhookURL != "" {
+		sink = outbox.WebhookSink{URL: cfg.OutboxWebhookURL, Client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	dispatcher := &outbox.Dispatcher{DB: db, Sinks: []outbox.Sink{sink, webhook.Fanout{DB: db}}}
+	deliverer := &webhook.Deliverer{DB: db}
+	var workers sync.WaitGroup
+	for _, worker := range []func(context.Context){dispatcher.Run, deliverer.Run} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(repository.WithQueryTimeout(ctx, queryTimeout))
+		}()
+	}
+	defer func() {
+		stop()
+		workers.Wait()
+	}()
+
+	probe := &server.Probe{DB: db}
+	routes := router.New(router.Deps{
+		DB: db, Keys: keys, Secret: secret, IssueTokens: cfg.JWT.IssueTokens,
+		QueryTimeout: queryTimeout, TrustedProxies: cfg.TrustedProxies, Probe: probe,
+	})
+	srv := &server.Server{
+		HTTP: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           routes,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		Probe:           probe,
+		ShutdownTimeout: time.Duration(cfg.ShutdownTimeout),
+		DrainDelay:      time.Duration(cfg.DrainDelay),
+	}
+	return srv.Run(ctx)
+}
 
-	r.Run(":8080")
+// runMigrate runs the migrate subcommand. create only writes files, so it
+// opens no database.
+func runMigrate(cfg config.DBConfig, args []string) error {
+	ctx := context.Background()
+	if len(args) > 0 && args[0] == "create" {
+		return migrate.Run(ctx, nil, "migrations", args, os.Stdout)
+	}
+	db, err := config.InitDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Run(ctx, &migrate.Migrator{DB: db, FS: migrations.FS}, "migrations", args, os.Stdout)
 }
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"rest-api/apperr"
+	"rest-api/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Errors   validation.Errors `json:"errors,omitempty"`
+}
+
+// StatusClientClosedRequest is the non-standard status, after nginx, of a
+// request whose client went away before the response.
+const StatusClientClosedRequest = 499
+
+var statuses = map[apperr.Kind]int{
+	apperr.KindInternal:             http.StatusInternalServerError,
+	apperr.KindBadRequest:           http.StatusBadRequest,
+	apperr.KindUnauthorized:         http.StatusUnauthorized,
+	apperr.KindForbidden:            http.StatusForbidden,
+	apperr.KindNotFound:             http.StatusNotFound,
+	apperr.KindConflict:             http.StatusConflict,
+	apperr.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	apperr.KindPreconditionRequired: http.StatusPreconditionRequired,
+	apperr.KindValidation:           http.StatusUnprocessableEntity,
+	apperr.KindTimeout:              http.StatusGatewayTimeout,
+	apperr.KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperr.KindUnavailable:          http.StatusServiceUnavailable,
+	apperr.KindTooManyRequests:      http.StatusTooManyRequests,
+	apperr.KindTooLarge:             http.StatusRequestEntityTooLarge,
+	apperr.KindCanceled:             StatusClientClosedRequest,
+}
+
+// Errors renders the last error a handler or middleware recorded with
+// c.Error as application/problem+json. It must run before them.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := apperr.As(c.Errors.Last().Err)
+		status := statuses[err.Kind]
+		if status >= http.StatusInternalServerError {
+			log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err.Err)
+		}
+		if err.Kind == apperr.KindUnauthorized {
+			c.Header("WWW-Authenticate", `Bearer, ApiKey`)
+		}
+		title := http.StatusText(status)
+		if status == StatusClientClosedRequest {
+			title = "Client Closed Request"
+		}
+		c.Header("Content-Type", "application/problem+json")
+		c.JSON(status, Problem{
+			Type:     "about:blank",
+			Title:    title,
+			Status:   status,
+			Detail:   err.Detail,
+			Instance: c.Request.URL.Path,
+			Errors:   err.Fields,
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"rest-api/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Literal guards a route with a colon inside a path segment, such as the
+// custom method /users:import. Gin reads that colon as a wildcard, so the
+// route also matches e.g. /usersfoo, which Literal answers with 404. It runs
+// first.
+func Literal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path != c.FullPath() {
+			c.Error(apperr.NotFound("no route for "+c.Request.URL.Path, nil))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"time"
+
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryTimeout bounds the queries of the request by d, for repositories with
+// no Timeout of their own.
+func QueryTimeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(repository.WithQueryTimeout(c.Request.Context(), d))
+		c.Next()
+	}
+}
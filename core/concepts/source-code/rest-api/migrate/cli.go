@@ -0,0 +1,111 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up            apply all pending migrations
+  down [n]      revert the last n migrations (default 1)
+  status        list migrations and when they were applied
+  create NAME   add an empty migration pair to the migrations directory`
+
+// Run implements the "migrate" subcommand shared by the services. dir is
+// the source directory of the embedded migrations, used by create.
+func Run(ctx context.Context, m *Migrator, dir string, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, mig := range done {
+			fmt.Fprintf(out, "applied %d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate: invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		done, err := m.Down(ctx, steps)
+		for _, mig := range done {
+			fmt.Fprintf(out, "reverted %d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	case "create":
+		if len(args) < 2 {
+			return errors.New("migrate: create needs a name")
+		}
+		up, down, err := Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created %s\ncreated %s\n", up, down)
+		return nil
+	}
+	return errors.New(usage)
+}
+
+var migrationName = regexp.MustCompile(`^\w+$`)
+
+// Create writes an empty up/down pair to dir, numbered after the latest
+// migration there, and returns their paths.
+func Create(dir, name string) (up, down string, err error) {
+	if !migrationName.MatchString(name) {
+		return "", "", fmt.Errorf("migrate: invalid name %q, use letters, digits and underscores", name)
+	}
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if n := len(migrations); n > 0 {
+		version = migrations[n-1].Version + 1
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down = base+".up.sql", base+".down.sql"
+	for path, direction := range map[string]string{up: "up", down: "down"} {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		fmt.Fprintf(f, "-- %s: %s migration\n", name, direction)
+		if err := f.Close(); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
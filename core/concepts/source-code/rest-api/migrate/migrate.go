@@ -0,0 +1,307 @@
+// Package migrate applies versioned SQL migrations, usually embedded in the
+// binary with embed.FS.
+//
+// Migrations are pairs of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, e.g. 0001_create_users.up.sql. Applied
+// versions are recorded in a schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"rest-api/repository"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration along with when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations at the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	hasUp := map[int64]bool{}
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by %q and %q", version, m.Name, match[2])
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up, hasUp[version] = string(body), true
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("migrate: %d_%s has no up migration", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies the migrations of FS to DB.
+//
+// Runs are serialized across processes: Postgres and MySQL take an advisory
+// lock, SQLite runs them in a single BEGIN IMMEDIATE transaction (use a
+// _busy_timeout so concurrent starts wait instead of failing). MySQL needs
+// multiStatements=true in its DSN for migrations with several statements.
+type Migrator struct {
+	DB      *sqlx.DB
+	FS      fs.FS
+	Table   string
+	Dialect repository.Dialect
+}
+
+func (m *Migrator) table() string {
+	if m.Table == "" {
+		return "schema_migrations"
+	}
+	return m.Table
+}
+
+func (m *Migrator) dialect() repository.Dialect {
+	if m.Dialect == nil {
+		return repository.DialectFor(m.DB.DriverName())
+	}
+	return m.Dialect
+}
+
+// Up applies every pending migration in order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, err := Load(m.FS)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and
+// returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Load(m.FS)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known migration and whether it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := Load(m.FS)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := m.DB.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Status, len(migrations))
+	for i, mig := range migrations {
+		status[i] = Status{Migration: mig}
+		if at, ok := applied[mig.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// locked runs fn on a dedicated connection while holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sqlx.Conn) error) (err error) {
+	conn, err := m.DB.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.dialect().Name() {
+	case "sqlite":
+		if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				conn.ExecContext(context.Background(), "ROLLBACK")
+				return
+			}
+			_, err = conn.ExecContext(ctx, "COMMIT")
+		}()
+	case "mysql":
+		var got sql.NullInt64
+		if err := conn.GetContext(ctx, &got, "SELECT GET_LOCK(?, -1)", m.table()); err != nil {
+			return err
+		}
+		if got.Int64 != 1 {
+			return errors.New("migrate: could not take the migration lock")
+		}
+		defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", m.table())
+	default:
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockID()); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockID())
+	}
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// lockID derives the Postgres advisory lock key from the table name, so
+// services sharing a database but not a migrations table do not block each
+// other.
+func (m *Migrator) lockID() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(m.table()))
+	return int64(h.Sum64())
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sqlx.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL)",
+		m.dialect().Quote(m.table())))
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sqlx.Conn) (map[int64]time.Time, error) {
+	var rows []struct {
+		Version   int64     `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	err := conn.SelectContext(ctx, &rows, "SELECT version, applied_at FROM "+m.dialect().Quote(m.table()))
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]time.Time, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+// apply runs one migration and records it. Each migration gets its own
+// transaction, except on SQLite where the whole run already is one.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, mig Migration, up bool) error {
+	d := m.dialect()
+	table := d.Quote(m.table())
+	script := mig.Up
+	record := "INSERT INTO " + table + " (version, name, applied_at) VALUES (?, ?, ?)"
+	args := []any{mig.Version, mig.Name, time.Now().UTC()}
+	if !up {
+		if mig.Down == "" {
+			return fmt.Errorf("migrate: %d_%s has no down migration", mig.Version, mig.Name)
+		}
+		script = mig.Down
+		record = "DELETE FROM " + table + " WHERE version = ?"
+		args = []any{mig.Version}
+	}
+	record, err := d.Placeholder().ReplacePlaceholders(record)
+	if err != nil {
+		return err
+	}
+
+	exec := func(db sqlx.ExecerContext) error {
+		if _, err := db.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("migrate: %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		_, err := db.ExecContext(ctx, record, args...)
+		return err
+	}
+	if d.Name() == "sqlite" {
+		return exec(conn)
+	}
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := exec(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
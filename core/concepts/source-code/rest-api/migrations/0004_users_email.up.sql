@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX users_email_key ON users (email) WHERE email <> '' AND deleted_at IS NULL;
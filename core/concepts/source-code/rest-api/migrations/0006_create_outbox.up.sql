@@ -0,0 +1,13 @@
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    aggregate TEXT NOT NULL,
+    aggregate_id TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    dispatched_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE dispatched_at IS NULL;
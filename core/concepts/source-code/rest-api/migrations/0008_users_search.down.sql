@@ -0,0 +1,4 @@
+DROP INDEX users_email_trgm_idx;
+DROP INDEX users_name_trgm_idx;
+DROP INDEX users_search_vector_idx;
+ALTER TABLE users DROP COLUMN search_vector;
@@ -0,0 +1,6 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+ALTER TABLE users
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || email)) STORED;
+CREATE INDEX users_search_vector_idx ON users USING GIN (search_vector);
+CREATE INDEX users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX users_email_trgm_idx ON users USING GIN (email gin_trgm_ops);
@@ -0,0 +1,2 @@
+DROP INDEX webhooks_owner_idx;
+ALTER TABLE webhooks DROP COLUMN owner;
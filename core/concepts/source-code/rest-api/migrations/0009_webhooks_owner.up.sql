@@ -0,0 +1,2 @@
+ALTER TABLE webhooks ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+CREATE INDEX webhooks_owner_idx ON webhooks (owner);
@@ -0,0 +1,7 @@
+// Package migrations embeds the rest-api schema migrations.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+type Product struct {
+	ID         int        `json:"id" db:"id,pk,auto"`
+	SKU        string     `json:"sku" binding:"required,max=64,unique" db:"sku"`
+	Name       string     `json:"name" binding:"required,min=2,max=200" db:"name"`
+	PriceCents int        `json:"price_cents" binding:"gte=0" db:"price_cents"`
+	Stock      int        `json:"stock" binding:"gte=0" db:"stock"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version    int        `json:"version" db:"version"`
+}
@@ -1,6 +1,13 @@
 package model
 
+import "time"
+
 type User struct {
-	ID   int    `json:"id" db:"id"`
-	Name string `json:"name" binding:"required" db:"name"`
+	ID        int        `json:"id" db:"id,pk,auto"`
+	Name      string     `json:"name" binding:"required,min=2,max=100" db:"name"`
+	Email     string     `json:"email" binding:"omitempty,email,max=254,unique" db:"email"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version   int        `json:"version" db:"version"`
 }
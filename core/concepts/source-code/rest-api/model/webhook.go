@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// Webhook subscribes a receiver URL to domain events.
+type Webhook struct {
+	ID int `json:"id" db:"id,pk,auto"`
+	// URL must be https, on a public host; see webhook.CheckURL.
+	URL string `json:"url" binding:"required,url,max=2048,webhookurl" db:"url"`
+	// Events are event types, e.g. "users.created", or patterns matching
+	// all the events of a table, "users.*", or all events, "*". They are
+	// stored like Scopes.
+	Events Scopes `json:"events" binding:"required,min=1,dive,eventtype" db:"events"`
+	// Secret signs the deliveries. It is never returned.
+	Secret string `json:"secret,omitempty" binding:"required,min=16,max=256" db:"secret"`
+	// Paused webhooks keep their pending deliveries until resumed.
+	Paused bool `json:"paused" db:"paused"`
+	// Owner is the subject of the credentials the webhook was created with.
+	// It is set by the server, and only its owner and admins see the webhook.
+	Owner     string    `json:"owner" db:"owner"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Version   int       `json:"version" db:"version"`
+}
+
+// Delivery statuses. Failed deliveries stay pending until they succeed or
+// run out of attempts, which makes them dead.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event to send to one webhook, and the log of the
+// attempts.
+type WebhookDelivery struct {
+	ID        int64  `json:"id" db:"id,pk,auto"`
+	WebhookID int    `json:"webhook_id" db:"webhook_id"`
+	EventID   int64  `json:"event_id" db:"event_id"`
+	EventType string `json:"event_type" db:"event_type"`
+	// Payload is the body sent to the receiver.
+	Payload       string     `json:"-" db:"payload"`
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatus    int        `json:"last_status,omitempty" db:"last_status"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
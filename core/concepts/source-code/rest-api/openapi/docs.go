@@ -0,0 +1,37 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+)
+
+// Docs serves Swagger UI, embedded in the binary, showing the document at
+// specURL. Mount it on a wildcard route such as /docs/*any.
+func Docs(specURL string) gin.HandlerFunc {
+	initializer := fmt.Sprintf(`window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: %q,
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`, specURL)
+	files := http.FileServer(swaggerFiles.HTTP)
+	return func(c *gin.Context) {
+		file := strings.TrimPrefix(c.Param("any"), "/")
+		if file == "swagger-initializer.js" {
+			c.Data(http.StatusOK, "application/javascript", []byte(initializer))
+			return
+		}
+		// An empty file serves the index of the root.
+		req := c.Request.Clone(c.Request.Context())
+		req.URL.Path = "/" + file
+		files.ServeHTTP(c.Writer, req)
+	}
+}
@@ -0,0 +1,425 @@
+// Package openapi generates an OpenAPI 3.1 document from the routes of a gin
+// engine, described next to where they are mounted, and serves it along with
+// Swagger UI.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"rest-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Document is the subset of an OpenAPI 3.1 document the generator writes.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	// Roles extends OpenAPI with the roles the caller must hold.
+	Roles []string `json:"x-roles,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Auth states what the middleware in front of a route requires.
+type Auth struct {
+	// Required is set behind AuthMiddleware, Optional behind OptionalAuth.
+	Required, Optional bool
+	Scopes             []string
+	Roles              []string
+}
+
+// Op describes one route. Path parameters, auth failures and error bodies
+// are derived from the route and Auth, so only the payloads need stating.
+type Op struct {
+	Summary string
+	Tags    []string
+	// Params are added to the path parameters, e.g. ListParams.
+	Params []Parameter
+	// Request is an example value of the body, e.g. model.User{}.
+	Request any
+	// RequestTypes defaults to application/json.
+	RequestTypes []string
+	// Response is an example value of the success body; nil means none.
+	Response any
+	// ResponseTypes defaults to application/json.
+	ResponseTypes []string
+	// Status defaults to 200.
+	Status int
+	// ETag is set when the response carries an ETag, and IfMatch when the
+	// request needs an If-Match header.
+	ETag, IfMatch bool
+	// RateLimited is set when a ratelimit policy guards the route.
+	RateLimited bool
+	Auth        Auth
+	// Errors lists error statuses the route returns besides the derived ones.
+	Errors []int
+}
+
+// Spec collects the Ops of the routes of one engine.
+type Spec struct {
+	Title, Version string
+
+	ops    map[string]Op
+	hidden map[string]bool
+	once   sync.Once
+	doc    []byte
+	err    error
+}
+
+func New(title, version string) *Spec {
+	return &Spec{Title: title, Version: version, ops: map[string]Op{}, hidden: map[string]bool{}}
+}
+
+// Add describes the route method path, with path in gin syntax.
+func (s *Spec) Add(method, path string, op Op) {
+	s.ops[method+" "+path] = op
+}
+
+// Hide leaves a route out of the document, e.g. the docs themselves.
+func (s *Spec) Hide(method, path string) {
+	s.hidden[method+" "+path] = true
+}
+
+// JSON generates the indented document of routes.
+func (s *Spec) JSON(routes gin.RoutesInfo) ([]byte, error) {
+	doc, err := s.Generate(routes)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	return append(out, '\n'), err
+}
+
+// Handler serves the document of r's routes. It is generated on the first
+// request, once every route is mounted.
+func (s *Spec) Handler(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.once.Do(func() { s.doc, s.err = s.JSON(r.Routes()) })
+		if s.err != nil {
+			c.Error(s.err)
+			return
+		}
+		c.Data(http.StatusOK, "application/json", s.doc)
+	}
+}
+
+// pathParam matches the wildcards of gin paths. Only those starting a
+// segment are parameters: a colon inside one, as in /users:import, names a
+// custom method, see middleware.Literal.
+var pathParam = regexp.MustCompile(`/[:*](\w+)`)
+
+// Generate builds the document of routes. Every route must have been
+// described, and every description must match a route, so that the
+// document cannot silently drift from the router.
+func (s *Spec) Generate(routes gin.RoutesInfo) (*Document, error) {
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info:    Info{Title: s.Title, Version: s.Version},
+		Paths:   map[string]map[string]Operation{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: securitySchemes,
+		},
+	}
+	schemas := &schemaSet{defs: doc.Components.Schemas}
+	schemas.ref(middleware.Problem{})
+
+	var errs []string
+	seen := map[string]bool{}
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		seen[key] = true
+		if s.hidden[key] {
+			continue
+		}
+		op, ok := s.ops[key]
+		if !ok {
+			errs = append(errs, "undocumented route "+key)
+			continue
+		}
+		path := pathParam.ReplaceAllString(route.Path, "/{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]Operation{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = s.operation(schemas, route, op)
+	}
+	for key := range s.ops {
+		if !seen[key] {
+			errs = append(errs, "no route for "+key)
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("openapi: %s", strings.Join(errs, "; "))
+	}
+	return doc, nil
+}
+
+func (s *Spec) operation(schemas *schemaSet, route gin.RouteInfo, op Op) Operation {
+	out := Operation{
+		OperationID: operationID(route.Method, route.Path),
+		Summary:     op.Summary,
+		Tags:        op.Tags,
+		Responses:   map[string]Response{},
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+		schema := &Schema{Type: "string"}
+		if m[1] == "id" {
+			schema = &Schema{Type: "integer"}
+		}
+		out.Parameters = append(out.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	out.Parameters = append(out.Parameters, op.Params...)
+	if op.IfMatch {
+		out.Parameters = append(out.Parameters, Parameter{
+			Name: "If-Match", In: "header", Required: true, Schema: &Schema{Type: "string"},
+			Description: "The ETag of the version being modified, or * for any version.",
+		})
+	}
+
+	if op.Request != nil {
+		types := op.RequestTypes
+		if len(types) == 0 {
+			types = []string{"application/json"}
+		}
+		out.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{}}
+		for _, t := range types {
+			schema := schemas.ref(op.Request)
+			switch t {
+			case "application/merge-patch+json":
+				schema = &Schema{Type: "object", Description: "An RFC 7396 merge patch of a " + strings.TrimPrefix(schema.Ref, "#/components/schemas/") + "."}
+			case "application/json-patch+json":
+				schema = schemas.ref([]PatchOperation{})
+			}
+			out.RequestBody.Content[t] = MediaType{Schema: schema}
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := Response{Description: http.StatusText(status)}
+	if op.Response != nil {
+		types := op.ResponseTypes
+		if len(types) == 0 {
+			types = []string{"application/json"}
+		}
+		ok.Content = map[string]MediaType{}
+		for _, t := range types {
+			ok.Content[t] = MediaType{Schema: schemas.ref(op.Response)}
+		}
+	}
+	if op.ETag {
+		ok.Headers = map[string]Header{"ETag": {Description: "The version of the returned entity.", Schema: &Schema{Type: "string"}}}
+	}
+	if op.RateLimited {
+		if ok.Headers == nil {
+			ok.Headers = map[string]Header{}
+		}
+		for name, h := range rateLimitHeaders {
+			ok.Headers[name] = h
+		}
+	}
+	out.Responses[strconv.Itoa(status)] = ok
+
+	errors := append([]int{}, op.Errors...)
+	if op.Auth.Required {
+		errors = append(errors, http.StatusUnauthorized)
+	}
+	if len(op.Auth.Scopes) > 0 || len(op.Auth.Roles) > 0 {
+		errors = append(errors, http.StatusForbidden)
+	}
+	if strings.Contains(route.Path, ":id") {
+		errors = append(errors, http.StatusNotFound)
+	}
+	if op.Request != nil {
+		errors = append(errors, http.StatusBadRequest, http.StatusUnprocessableEntity)
+	}
+	if op.IfMatch {
+		errors = append(errors, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+	}
+	if op.RateLimited {
+		errors = append(errors, http.StatusTooManyRequests)
+	}
+	for _, code := range errors {
+		out.Responses[strconv.Itoa(code)] = Response{
+			Description: http.StatusText(code),
+			Content:     map[string]MediaType{"application/problem+json": {Schema: &Schema{Ref: "#/components/schemas/Problem"}}},
+		}
+	}
+	if op.RateLimited {
+		limited := out.Responses[strconv.Itoa(http.StatusTooManyRequests)]
+		limited.Headers = map[string]Header{"Retry-After": {Description: "Seconds to wait before retrying.", Schema: &Schema{Type: "integer"}}}
+		for name, h := range rateLimitHeaders {
+			limited.Headers[name] = h
+		}
+		out.Responses[strconv.Itoa(http.StatusTooManyRequests)] = limited
+	}
+
+	out.Security = security(op.Auth)
+	out.Roles = op.Auth.Roles
+	if len(op.Auth.Roles) > 0 {
+		out.Description = "Requires the role " + strings.Join(op.Auth.Roles, ", ") + "."
+	}
+	return out
+}
+
+var rateLimitHeaders = map[string]Header{
+	"RateLimit-Policy":    {Description: `The policy, as "<rate>;w=<seconds>".`, Schema: &Schema{Type: "string"}},
+	"RateLimit-Limit":     {Description: "The burst size.", Schema: &Schema{Type: "integer"}},
+	"RateLimit-Remaining": {Description: "The requests left in the current burst.", Schema: &Schema{Type: "integer"}},
+	"RateLimit-Reset":     {Description: "Seconds until the burst is fully available again.", Schema: &Schema{Type: "integer"}},
+}
+
+var securitySchemes = map[string]SecurityScheme{
+	"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+	"apiKey": {Type: "apiKey", In: "header", Name: "Authorization", Description: `An API key, sent as "ApiKey <key>".`},
+}
+
+// security lists the accepted credentials. Scopes are given as the roles of
+// each scheme, which OpenAPI 3.1 allows for schemes other than OAuth.
+func security(a Auth) []map[string][]string {
+	if !a.Required && !a.Optional {
+		return nil
+	}
+	scopes := a.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	var out []map[string][]string
+	if a.Optional {
+		out = append(out, map[string][]string{})
+	}
+	return append(out, map[string][]string{"bearer": scopes}, map[string][]string{"apiKey": scopes})
+}
+
+// operationID turns "GET /users/:id/restore" into "getUsersIdRestore".
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return !isAlnum(r) }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func isAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// ListParams describes the query of list routes, see crud.ParseListQuery.
+func ListParams(filters, sorts []string) []Parameter {
+	params := make([]Parameter, 0, len(filters)+3)
+	for _, f := range filters {
+		params = append(params, Parameter{
+			Name: "filter[" + f + "]", In: "query", Schema: &Schema{Type: "string"},
+			Description: "Filters on " + f + "; filter[" + f + "][op] takes ne, in, like, gt, gte, lt or lte.",
+		})
+	}
+	var sortEnum []any
+	for _, s := range sorts {
+		sortEnum = append(sortEnum, s, "-"+s)
+	}
+	return append(params,
+		Parameter{Name: "sort", In: "query", Description: "Comma separated fields, descending when prefixed with -.",
+			Explode: ptr(false), Schema: &Schema{Type: "array", Items: &Schema{Type: "string", Enum: sortEnum}}},
+		Parameter{Name: "cursor", In: "query", Description: "The next_cursor of the previous page.", Schema: &Schema{Type: "string"}},
+		Parameter{Name: "size", In: "query", Schema: &Schema{Type: "integer", Minimum: ptr(1.0)}},
+	)
+}
+
+// Status is the body of routes that only acknowledge, e.g. deletes.
+type Status struct {
+	Status string `json:"status"`
+}
+
+// PatchOperation is one RFC 6902 operation.
+type PatchOperation struct {
+	Op    string `json:"op" binding:"required,oneof=add remove replace move copy test"`
+	Path  string `json:"path" binding:"required"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// SearchParams describes the query of search routes, whose text is at most
+// maxLength long.
+func SearchParams(maxLength int) []Parameter {
+	return []Parameter{
+		{Name: "q", In: "query", Required: true, Description: "The words to look for.",
+			Schema: &Schema{Type: "string", MinLength: ptr(1), MaxLength: ptr(maxLength)}},
+		{Name: "cursor", In: "query", Description: "The next_cursor of the previous page.", Schema: &Schema{Type: "string"}},
+		{Name: "size", In: "query", Schema: &Schema{Type: "integer", Minimum: ptr(1.0)}},
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,219 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema, as used by OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+}
+
+// readOnlyColumns are maintained by the repository or the handlers, e.g. the
+// owner of a webhook, never by clients.
+var readOnlyColumns = map[string]bool{"created_at": true, "updated_at": true, "deleted_at": true, "version": true, "owner": true}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaSet turns Go types into schemas, named structs becoming components
+// referenced by $ref.
+type schemaSet struct {
+	defs map[string]*Schema
+}
+
+// ref returns the schema of the type of v.
+func (s *schemaSet) ref(v any) *Schema {
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *schemaSet) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if typ, ok := schema.Type.(string); ok {
+			schema.Type = []string{typ, "null"}
+		}
+		return schema
+	case t.Kind() == reflect.Struct && t.Name() == "":
+		return s.object(t)
+	case t.Kind() == reflect.Struct:
+		name := componentName(t)
+		if _, ok := s.defs[name]; !ok {
+			// Reserve the name first so recursive types terminate.
+			s.defs[name] = nil
+			s.defs[name] = s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: "string", Format: "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	return &Schema{}
+}
+
+// object describes the JSON object of struct t, with the constraints of its
+// binding tags. Embedded structs without a json name are flattened.
+func (s *schemaSet) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := s.object(f.Type)
+			for k, v := range embedded.Properties {
+				schema.Properties[k] = v
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := s.schema(f.Type)
+		field, items, required := splitRules(f.Tag.Get("binding"))
+		constrain(prop, f.Type, field)
+		if prop.Items != nil && f.Type.Kind() == reflect.Slice {
+			constrain(prop.Items, f.Type.Elem(), items)
+		}
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+		column, opts, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if readOnlyColumns[column] || hasOption(opts, "auto") || hasOption(opts, "readonly") {
+			prop.ReadOnly = true
+		}
+		schema.Properties[name] = prop
+	}
+	return schema
+}
+
+// splitRules separates the rules of a field from those applied to its items
+// after dive.
+func splitRules(tag string) (field, items []string, required bool) {
+	rules := &field
+	for _, r := range strings.Split(tag, ",") {
+		switch {
+		case r == "dive":
+			rules = &items
+		case r == "required" && rules == &field:
+			required = true
+		case r != "":
+			*rules = append(*rules, r)
+		}
+	}
+	return field, items, required
+}
+
+func hasOption(opts, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// constrain translates validator rules into schema keywords. Rules with no
+// equivalent, e.g. unique, are left out.
+func constrain(schema *Schema, t reflect.Type, rules []string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		n, err := strconv.ParseFloat(param, 64)
+		hasNum := err == nil
+		switch {
+		case name == "email":
+			schema.Format = "email"
+		case name == "url":
+			schema.Format = "uri"
+		case name == "uuid":
+			schema.Format = "uuid"
+		case name == "oneof":
+			for _, v := range strings.Fields(param) {
+				if i, err := strconv.Atoi(v); err == nil && t.Kind() != reflect.String {
+					schema.Enum = append(schema.Enum, i)
+				} else {
+					schema.Enum = append(schema.Enum, v)
+				}
+			}
+		case !hasNum:
+		case t.Kind() == reflect.String:
+			switch name {
+			case "min":
+				schema.MinLength = ptr(int(n))
+			case "max":
+				schema.MaxLength = ptr(int(n))
+			case "len":
+				schema.MinLength, schema.MaxLength = ptr(int(n)), ptr(int(n))
+			}
+		case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+			switch name {
+			case "min":
+				schema.MinItems = ptr(int(n))
+			case "max":
+				schema.MaxItems = ptr(int(n))
+			case "len":
+				schema.MinItems, schema.MaxItems = ptr(int(n)), ptr(int(n))
+			}
+		default:
+			switch name {
+			case "min", "gte":
+				schema.Minimum = ptr(n)
+			case "max", "lte":
+				schema.Maximum = ptr(n)
+			case "gt":
+				schema.ExclusiveMinimum = ptr(n)
+			case "lt":
+				schema.ExclusiveMaximum = ptr(n)
+			}
+		}
+	}
+}
+
+var packagePath = regexp.MustCompile(`[\w./-]*\.`)
+
+// componentName names t without its package, e.g. "User", and instances of
+// generic types after their arguments, e.g. "Page_User".
+func componentName(t reflect.Type) string {
+	name := packagePath.ReplaceAllString(t.Name(), "")
+	return strings.NewReplacer("[", "_", "]", "", ",", "_", "*", "").Replace(name)
+}
@@ -0,0 +1,184 @@
+// Package outbox delivers the events that repositories record in the outbox
+// table to sinks, at least once.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"rest-api/repository"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// Dispatcher polls the outbox and hands each pending event to every sink, in
+// id order. An event is marked dispatched once all sinks accepted it;
+// otherwise it is retried with exponential backoff, and sinks may see it
+// again, so consumers should deduplicate on the event id.
+type Dispatcher struct {
+	DB     *sqlx.DB
+	Outbox repository.Outbox
+	Sinks  []Sink
+	// Interval between polls, 1s by default.
+	Interval time.Duration
+	// BatchSize bounds the events handled per poll, 100 by default and at
+	// most repository.MaxLimit.
+	BatchSize int
+	// MaxAttempts stops retrying an event, which keeps its last error for
+	// inspection. It defaults to 10.
+	MaxAttempts int
+	// Backoff is the wait after the given failed attempt, by default 1s
+	// doubled per attempt up to an hour.
+	Backoff func(attempt int) time.Duration
+	// Lease is how long a claimed event is hidden from other dispatchers
+	// while it is delivered, 1m by default.
+	Lease time.Duration
+}
+
+// Run dispatches until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(or(d.Interval, time.Second))
+	defer ticker.Stop()
+	for {
+		if _, err := d.DispatchOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("outbox: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce handles one batch of pending events and returns how many were
+// delivered.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	events := d.Outbox.Events(d.DB)
+	batch := d.BatchSize
+	if batch == 0 {
+		batch = 100
+	}
+	page, err := events.List(ctx, repository.Query{
+		Filters: []repository.Filter{
+			{Field: "dispatched_at", Op: repository.OpEq, Value: nil},
+			{Field: "attempts", Op: repository.OpLt, Value: d.maxAttempts()},
+			{Field: "next_attempt_at", Op: repository.OpLte, Value: time.Now().UTC()},
+		},
+		Limit:          batch,
+		AllowedFilters: []string{"dispatched_at", "attempts", "next_attempt_at"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, e := range page.Data {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		claimed, err := d.claim(ctx, e)
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue
+		}
+		e.Attempts++
+		if err := d.deliver(ctx, e); err != nil {
+			log.Printf("outbox: event %d (%s), attempt %d: %v", e.ID, e.Type, e.Attempts, err)
+			if err := d.fail(ctx, e, err); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := d.set(ctx, e.ID, map[string]any{"dispatched_at": time.Now().UTC(), "last_error": ""}); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts == 0 {
+		return 10
+	}
+	return d.MaxAttempts
+}
+
+// claim counts the attempt and hides the event for the lease, unless another
+// dispatcher claimed it first.
+func (d *Dispatcher) claim(ctx context.Context, e repository.Event) (bool, error) {
+	dialect := repository.DialectFor(d.DB.DriverName())
+	query, args, err := sq.Update(dialect.Quote(d.Outbox.TableName())).
+		Set("attempts", e.Attempts+1).
+		Set("next_attempt_at", time.Now().UTC().Add(or(d.Lease, time.Minute))).
+		Where(sq.Eq{"id": e.ID, "attempts": e.Attempts, "dispatched_at": nil}).
+		PlaceholderFormat(dialect.Placeholder()).ToSql()
+	if err != nil {
+		return false, err
+	}
+	res, err := d.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, e repository.Event) error {
+	var errs []error
+	for _, sink := range d.Sinks {
+		if err := sink.Send(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fail schedules the next attempt of e.
+func (d *Dispatcher) fail(ctx context.Context, e repository.Event, cause error) error {
+	backoff := d.Backoff
+	if backoff == nil {
+		backoff = Exponential(time.Second, time.Hour)
+	}
+	return d.set(ctx, e.ID, map[string]any{
+		"next_attempt_at": time.Now().UTC().Add(backoff(e.Attempts)),
+		"last_error":      cause.Error(),
+	})
+}
+
+func (d *Dispatcher) set(ctx context.Context, id int64, values map[string]any) error {
+	dialect := repository.DialectFor(d.DB.DriverName())
+	query, args, err := sq.Update(dialect.Quote(d.Outbox.TableName())).SetMap(values).Where(sq.Eq{"id": id}).
+		PlaceholderFormat(dialect.Placeholder()).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := d.DB.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("outbox: event %d: %w", id, err)
+	}
+	return nil
+}
+
+// Exponential returns a backoff of base doubled per attempt, up to max.
+func Exponential(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		return min(d, max)
+	}
+}
+
+func or(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"rest-api/repository"
+)
+
+// Sink receives the events. An error makes the dispatcher retry the event
+// later, on every sink.
+type Sink interface {
+	Send(ctx context.Context, e repository.Event) error
+}
+
+// SinkFunc adapts a func to Sink.
+type SinkFunc func(ctx context.Context, e repository.Event) error
+
+func (f SinkFunc) Send(ctx context.Context, e repository.Event) error {
+	return f(ctx, e)
+}
+
+// LogSink logs the events, e.g. during development.
+type LogSink struct {
+	// Logger defaults to the standard logger.
+	Logger *log.Logger
+}
+
+func (s LogSink) Send(_ context.Context, e repository.Event) error {
+	logger := s.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("event %d %s %s: %s", e.ID, e.Type, e.AggregateID, e.Payload)
+	return nil
+}
+
+// Channel sends the events to in-process consumers. A full channel blocks
+// the dispatcher until a consumer reads or ctx is done.
+func Channel(ch chan<- repository.Event) Sink {
+	return SinkFunc(func(ctx context.Context, e repository.Event) error {
+		select {
+		case ch <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// WebhookSink POSTs each event as JSON to URL. Any status but 2xx is a
+// failure.
+type WebhookSink struct {
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (s WebhookSink) Send(ctx context.Context, e repository.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(e.ID, 10))
+	req.Header.Set("X-Event-Type", e.Type)
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: %s", s.URL, resp.Status)
+	}
+	return nil
+}
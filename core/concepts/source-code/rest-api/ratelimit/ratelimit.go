@@ -0,0 +1,96 @@
+// Package ratelimit limits the requests of each client with token buckets,
+// answering 429 with the Retry-After and RateLimit-* headers.
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"rest-api/apperr"
+	"rest-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy allows Rate requests per Period, in bursts of up to Burst.
+type Policy struct {
+	// Name separates the buckets of the policies applied to one client.
+	Name   string
+	Rate   int
+	Period time.Duration
+	// Burst defaults to Rate.
+	Burst int
+}
+
+func (p Policy) burst() int {
+	if p.Burst == 0 {
+		return p.Rate
+	}
+	return p.Burst
+}
+
+// KeyFunc identifies the client of a request.
+type KeyFunc func(c *gin.Context) string
+
+// ByClient keys authenticated callers by subject, which is "apikey:<id>" for
+// API keys, and anonymous ones by IP. Put the limit after the auth
+// middleware for the subject to be known.
+func ByClient(c *gin.Context) string {
+	if claims, ok := middleware.Claims(c); ok && claims.Subject != "" {
+		return "sub:" + claims.Subject
+	}
+	return ByIP(c)
+}
+
+// ByIP keys every caller by IP, e.g. for login routes. X-Forwarded-For is
+// only believed from the trusted proxies of the engine, so that clients
+// cannot pick their own key.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+type Limiter struct {
+	Store Store
+	// Key defaults to ByClient.
+	Key KeyFunc
+}
+
+// Limit applies p to the routes it guards. Store failures are logged and let
+// the request through, so that the limiter never takes the API down.
+func (l Limiter) Limit(p Policy) gin.HandlerFunc {
+	if p.Rate <= 0 || p.Period <= 0 {
+		panic(fmt.Sprintf("ratelimit: policy %q needs a positive rate and period", p.Name))
+	}
+	key := l.Key
+	if key == nil {
+		key = ByClient
+	}
+	return func(c *gin.Context) {
+		res, err := l.Store.Take(c.Request.Context(), p.Name+":"+key(c), p)
+		if err != nil {
+			log.Printf("ratelimit: %s: %v", p.Name, err)
+			c.Next()
+			return
+		}
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Rate, int(p.Period.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceil(res.Reset))
+		if !res.Allowed {
+			c.Header("Retry-After", ceil(res.RetryAfter))
+			c.Error(apperr.TooManyRequests("too many requests, retry in " + ceil(res.RetryAfter) + "s"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ceil formats d in whole seconds, rounded up so that clients never retry
+// too early.
+func ceil(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
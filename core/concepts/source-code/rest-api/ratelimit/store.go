@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the state of a bucket after a Take.
+type Result struct {
+	Allowed bool
+	// Limit is the burst of the policy and Remaining the whole tokens left.
+	Limit, Remaining int
+	// RetryAfter is the wait for the next token when the take was refused.
+	RetryAfter time.Duration
+	// Reset is the wait until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps the buckets. MemoryStore suits a single instance; a shared
+// store, e.g. on Redis, is needed to limit across replicas.
+type Store interface {
+	// Take removes a token from the bucket of key, which starts full.
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// MemoryStore keeps the buckets in memory. The zero value is ready to use.
+type MemoryStore struct {
+	// IdleTimeout evicts buckets unused for that long, 10 minutes by
+	// default. It should exceed the Period of the policies, so that evicted
+	// buckets were full anyway.
+	IdleTimeout time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, p Policy) (Result, error) {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.burst()), last: now}
+		s.buckets[key] = b
+	}
+	return b.take(p, now), nil
+}
+
+// Len returns the number of buckets held.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// sweep drops the idle buckets, at most once per IdleTimeout so that takes
+// stay cheap.
+func (s *MemoryStore) sweep(now time.Time) {
+	idle := s.IdleTimeout
+	if idle == 0 {
+		idle = 10 * time.Minute
+	}
+	if s.buckets == nil {
+		s.buckets = map[string]*bucket{}
+		s.lastSweep = now
+	}
+	if now.Sub(s.lastSweep) < idle {
+		return
+	}
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// take refills the bucket for the time elapsed since the last take, then
+// removes a token if there is one.
+func (b *bucket) take(p Policy, now time.Time) Result {
+	rate := float64(p.Rate) / p.Period.Seconds()
+	burst := float64(p.burst())
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: p.burst()}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / rate)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CachedRepository serves GetByID from an in-process LRU cache in front of
+// an SQLRepository, whose other methods it shares. Concurrent misses of an
+// id are loaded once. Writes through it evict the entry; writes made
+// elsewhere, e.g. by another instance or InTx, show after at most TTL.
+type CachedRepository[T any] struct {
+	*SQLRepository[T]
+
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// gen counts invalidations, so that a load that raced with a write is
+	// not cached.
+	gen   uint64
+	group singleflight.Group
+
+	hits, misses, evictions atomic.Uint64
+}
+
+type cacheEntry[T any] struct {
+	key     string
+	value   T
+	expires time.Time
+}
+
+// CacheStats are the counters of a CachedRepository since its creation.
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+	Size                    int
+}
+
+// NewCachedRepository caches up to size entities of repo, each for ttl.
+func NewCachedRepository[T any](repo *SQLRepository[T], size int, ttl time.Duration) *CachedRepository[T] {
+	if size <= 0 || ttl <= 0 {
+		panic("repository: cache size and ttl must be positive")
+	}
+	return &CachedRepository[T]{
+		SQLRepository: repo,
+		size:          size,
+		ttl:           ttl,
+		entries:       map[string]*list.Element{},
+		lru:           list.New(),
+	}
+}
+
+var _ Repository[struct{}] = (*CachedRepository[struct{}])(nil)
+
+// cacheKey makes ids of composite keys comparable, and 1 and int64(1) equal.
+func cacheKey(id any) string {
+	return fmt.Sprint(id)
+}
+
+// GetByID returns a copy of the cached entity, loading it on a miss. Errors,
+// including ErrNotFound, are not cached.
+func (r *CachedRepository[T]) GetByID(ctx context.Context, id any) (*T, error) {
+	key := cacheKey(id)
+	if entity, ok := r.get(key); ok {
+		r.hits.Add(1)
+		return entity, nil
+	}
+	r.misses.Add(1)
+
+	// The load outlives a caller that gives up, as others may wait on it.
+	ch := r.group.DoChan(key, func() (any, error) {
+		r.mu.Lock()
+		gen := r.gen
+		r.mu.Unlock()
+		entity, err := r.SQLRepository.GetByID(context.WithoutCancel(ctx), id)
+		if err != nil {
+			return nil, err
+		}
+		r.put(key, *entity, gen)
+		return *entity, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		entity := res.Val.(T)
+		return &entity, nil
+	}
+}
+
+func (r *CachedRepository[T]) get(key string) (*T, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	el, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry[T])
+	if time.Now().After(e.expires) {
+		r.remove(el)
+		return nil, false
+	}
+	r.lru.MoveToFront(el)
+	entity := e.value
+	return &entity, true
+}
+
+// put caches entity unless an invalidation happened since gen was read.
+func (r *CachedRepository[T]) put(key string, entity T, gen uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen != gen {
+		return
+	}
+	if el, ok := r.entries[key]; ok {
+		r.remove(el)
+	}
+	r.entries[key] = r.lru.PushFront(&cacheEntry[T]{key: key, value: entity, expires: time.Now().Add(r.ttl)})
+	for r.lru.Len() > r.size {
+		r.remove(r.lru.Back())
+		r.evictions.Add(1)
+	}
+}
+
+func (r *CachedRepository[T]) remove(el *list.Element) {
+	r.lru.Remove(el)
+	delete(r.entries, el.Value.(*cacheEntry[T]).key)
+}
+
+// Invalidate evicts id, e.g. after writing it in a transaction.
+func (r *CachedRepository[T]) Invalidate(id any) {
+	key := cacheKey(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gen++
+	if el, ok := r.entries[key]; ok {
+		r.remove(el)
+	}
+	r.group.Forget(key)
+}
+
+// Stats returns the hit and miss counters and the number of entries.
+func (r *CachedRepository[T]) Stats() CacheStats {
+	r.mu.Lock()
+	size := r.lru.Len()
+	r.mu.Unlock()
+	return CacheStats{Hits: r.hits.Load(), Misses: r.misses.Load(), Evictions: r.evictions.Load(), Size: size}
+}
+
+// The writes below evict the entity both before, so that no load started
+// meanwhile gets cached, and whatever their outcome, since a failed write
+// may still have changed the row, e.g. on a timeout after the commit.
+
+func (r *CachedRepository[T]) Update(ctx context.Context, id any, entity *T) error {
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.Update(ctx, id, entity)
+}
+
+func (r *CachedRepository[T]) UpdateFields(ctx context.Context, id any, fields map[string]any) (*T, error) {
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.UpdateFields(ctx, id, fields)
+}
+
+func (r *CachedRepository[T]) UpdateFieldsWhere(ctx context.Context, id any, fields map[string]any, filters ...Filter) (*T, error) {
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.UpdateFieldsWhere(ctx, id, fields, filters...)
+}
+
+func (r *CachedRepository[T]) Upsert(ctx context.Context, entity *T) error {
+	id := modelOf[T]().key(reflect.ValueOf(entity).Elem())
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.Upsert(ctx, entity)
+}
+
+func (r *CachedRepository[T]) Delete(ctx context.Context, id any) error {
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.Delete(ctx, id)
+}
+
+func (r *CachedRepository[T]) HardDelete(ctx context.Context, id any) error {
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.HardDelete(ctx, id)
+}
+
+func (r *CachedRepository[T]) Restore(ctx context.Context, id any) error {
+	defer r.Invalidate(id)
+	r.Invalidate(id)
+	return r.SQLRepository.Restore(ctx, id)
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Dialect hides the SQL differences between the databases SQLRepository
+// can talk to.
+type Dialect interface {
+	Name() string
+	Placeholder() sq.PlaceholderFormat
+	// Quote quotes an identifier, keeping "schema.table" qualifiers apart.
+	Quote(ident string) string
+	// Returning reports whether INSERT/UPDATE ... RETURNING is available.
+	Returning() bool
+	// Upsert returns the clause appended to an INSERT so that a conflict on
+	// keys updates the given columns instead of failing.
+	Upsert(keys, columns []string) string
+	// IsUniqueViolation reports whether err is the driver's error for a
+	// broken unique constraint.
+	IsUniqueViolation(err error) bool
+}
+
+var (
+	Postgres Dialect = postgres{}
+	SQLite   Dialect = sqlite{}
+	MySQL    Dialect = mysql{}
+)
+
+// DialectFor returns the dialect matching a database/sql driver name.
+func DialectFor(driver string) Dialect {
+	switch driver {
+	case "sqlite3", "sqlite":
+		return SQLite
+	case "mysql":
+		return MySQL
+	}
+	return Postgres
+}
+
+type postgres struct{}
+
+func (postgres) Name() string                      { return "postgres" }
+func (postgres) Placeholder() sq.PlaceholderFormat { return sq.Dollar }
+func (postgres) Quote(ident string) string         { return quote(ident, `"`) }
+func (postgres) Returning() bool                   { return true }
+
+func (d postgres) Upsert(keys, columns []string) string {
+	return onConflict(d, keys, columns)
+}
+
+// IsUniqueViolation checks SQLSTATE 23505, exposed by both lib/pq and pgx.
+func (postgres) IsUniqueViolation(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == "23505"
+}
+
+// sqlite re-reads written rows instead of relying on RETURNING, which older
+// SQLite builds do not support.
+type sqlite struct{}
+
+func (sqlite) Name() string                      { return "sqlite" }
+func (sqlite) Placeholder() sq.PlaceholderFormat { return sq.Question }
+func (sqlite) Quote(ident string) string         { return quote(ident, `"`) }
+func (sqlite) Returning() bool                   { return false }
+
+func (d sqlite) Upsert(keys, columns []string) string {
+	return onConflict(d, keys, columns)
+}
+
+// IsUniqueViolation matches the message of SQLITE_CONSTRAINT_UNIQUE and
+// SQLITE_CONSTRAINT_PRIMARYKEY, so that the cgo driver need not be imported.
+func (sqlite) IsUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+type mysql struct{}
+
+func (mysql) Name() string                      { return "mysql" }
+func (mysql) Placeholder() sq.PlaceholderFormat { return sq.Question }
+func (mysql) Quote(ident string) string         { return quote(ident, "`") }
+func (mysql) Returning() bool                   { return false }
+
+func (d mysql) Upsert(keys, columns []string) string {
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		set[i] = fmt.Sprintf("%s = VALUES(%s)", d.Quote(c), d.Quote(c))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+}
+
+// IsUniqueViolation matches MySQL error 1062 (ER_DUP_ENTRY).
+func (mysql) IsUniqueViolation(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "Error 1062")
+}
+
+func onConflict(d Dialect, keys, columns []string) string {
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = d.Quote(k)
+	}
+	if len(columns) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(quoted, ", "))
+	}
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		set[i] = fmt.Sprintf("%s = EXCLUDED.%s", d.Quote(c), d.Quote(c))
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quoted, ", "), strings.Join(set, ", "))
+}
+
+func quote(ident, q string) string {
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		parts[i] = q + strings.ReplaceAll(p, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
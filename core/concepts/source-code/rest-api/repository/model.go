@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key identifies a row whose primary key spans several columns, in the
+// order the pk fields are declared.
+type Key []any
+
+// field describes one db-mapped struct field. Options follow the column name
+// in the db tag, e.g. `db:"id,pk,auto"`:
+//
+//	pk        part of the primary key
+//	auto      generated by the database on insert (serial, autoincrement)
+//	readonly  read but never written (e.g. database defaults)
+//	omitempty not written when it holds its zero value
+type field struct {
+	column    string
+	index     []int
+	typ       reflect.Type
+	pk        bool
+	auto      bool
+	readonly  bool
+	omitempty bool
+}
+
+// model describes how T maps to a table. Columns named created_at,
+// updated_at and deleted_at opt the model into audit timestamps and soft
+// deletes; a version column opts it into optimistic locking.
+type model struct {
+	fields    []*field
+	pk        []*field
+	createdAt *field
+	updatedAt *field
+	deletedAt *field
+	version   *field
+}
+
+var models sync.Map // reflect.Type -> *model
+
+// modelOf returns the cached descriptor of T, building it on first use.
+func modelOf[T any]() *model {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if m, ok := models.Load(typ); ok {
+		return m.(*model)
+	}
+	m, _ := models.LoadOrStore(typ, buildModel(typ))
+	return m.(*model)
+}
+
+func buildModel(typ reflect.Type) *model {
+	m := &model{}
+	collectFields(m, typ, nil)
+	for _, f := range m.fields {
+		if f.pk {
+			m.pk = append(m.pk, f)
+		}
+	}
+	// Without pk tags, a column named id is the auto-generated primary key.
+	if len(m.pk) == 0 {
+		if f := m.field("id"); f != nil {
+			f.pk, f.auto = true, true
+			m.pk = []*field{f}
+		}
+	}
+	m.createdAt = m.field("created_at")
+	m.updatedAt = m.field("updated_at")
+	m.deletedAt = m.field("deleted_at")
+	m.version = m.field("version")
+	return m
+}
+
+func collectFields(m *model, typ reflect.Type, index []int) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		idx := append(append([]int{}, index...), i)
+		tag := sf.Tag.Get("db")
+		if tag == "-" || !sf.IsExported() {
+			continue
+		}
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			collectFields(m, sf.Type, idx)
+			continue
+		}
+		if tag == "" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := &field{column: opts[0], index: idx, typ: sf.Type}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "pk":
+				f.pk = true
+			case "auto":
+				f.auto = true
+			case "readonly":
+				f.readonly = true
+			case "omitempty":
+				f.omitempty = true
+			}
+		}
+		m.fields = append(m.fields, f)
+	}
+}
+
+func (m *model) field(column string) *field {
+	for _, f := range m.fields {
+		if f.column == column {
+			return f
+		}
+	}
+	return nil
+}
+
+func (m *model) columns() []string {
+	columns := make([]string, len(m.fields))
+	for i, f := range m.fields {
+		columns[i] = f.column
+	}
+	return columns
+}
+
+func (m *model) pkColumns() []string {
+	columns := make([]string, len(m.pk))
+	for i, f := range m.pk {
+		columns[i] = f.column
+	}
+	return columns
+}
+
+// autoPK returns the single auto-generated primary key field, if any.
+func (m *model) autoPK() *field {
+	if len(m.pk) == 1 && m.pk[0].auto {
+		return m.pk[0]
+	}
+	return nil
+}
+
+func (f *field) value(entity reflect.Value) reflect.Value {
+	return entity.FieldByIndex(f.index)
+}
+
+// insertValues returns the columns written by an INSERT. Primary keys are
+// only written when withPK is set or when they are not generated.
+func (m *model) insertValues(entity reflect.Value, withPK bool) map[string]any {
+	values := map[string]any{}
+	for _, f := range m.fields {
+		v := f.value(entity)
+		switch {
+		case f.readonly || f == m.deletedAt:
+		case f.auto && !(f.pk && withPK):
+		case f.omitempty && v.IsZero():
+		default:
+			values[f.column] = v.Interface()
+		}
+	}
+	return values
+}
+
+// updateValues returns the columns written by an UPDATE.
+func (m *model) updateValues(entity reflect.Value) map[string]any {
+	values := map[string]any{}
+	for _, f := range m.fields {
+		v := f.value(entity)
+		if !m.writable(f) || (f.omitempty && v.IsZero()) {
+			continue
+		}
+		values[f.column] = v.Interface()
+	}
+	return values
+}
+
+// writable reports whether an UPDATE may set f. Audit columns and versions
+// are maintained by the repository itself.
+func (m *model) writable(f *field) bool {
+	if f.pk || f.auto || f.readonly {
+		return false
+	}
+	return f != m.createdAt && f != m.deletedAt && f != m.version
+}
+
+// Changes returns the writable columns whose value differs between before
+// and after, with their value in after, as accepted by UpdateFields.
+// updated_at is left out since every update stamps it anyway.
+func Changes[T any](before, after *T) map[string]any {
+	m := modelOf[T]()
+	b, a := reflect.ValueOf(before).Elem(), reflect.ValueOf(after).Elem()
+	changes := map[string]any{}
+	for _, f := range m.fields {
+		if !m.writable(f) || f == m.updatedAt {
+			continue
+		}
+		if !equal(f.value(b).Interface(), f.value(a).Interface()) {
+			changes[f.column] = f.value(a).Interface()
+		}
+	}
+	return changes
+}
+
+// equal compares times by instant, as a JSON round trip loses their
+// location.
+func equal(x, y any) bool {
+	switch x := x.(type) {
+	case time.Time:
+		return x.Equal(y.(time.Time))
+	case *time.Time:
+		y := y.(*time.Time)
+		if x == nil || y == nil {
+			return x == y
+		}
+		return x.Equal(*y)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// touch stamps the audit timestamps of entity before a write, and starts
+// new rows at version 1.
+func (m *model) touch(entity reflect.Value, now time.Time, created bool) {
+	if created && m.version != nil {
+		m.version.value(entity).SetInt(1)
+	}
+	if created && m.createdAt != nil {
+		setTime(m.createdAt.value(entity), now)
+	}
+	if m.updatedAt != nil {
+		setTime(m.updatedAt.value(entity), now)
+	}
+}
+
+func setTime(v reflect.Value, t time.Time) {
+	switch v.Interface().(type) {
+	case time.Time:
+		v.Set(reflect.ValueOf(t))
+	case *time.Time:
+		v.Set(reflect.ValueOf(&t))
+	}
+}
+
+// key reads the primary key of entity as a value accepted by keyValues.
+func (m *model) key(entity reflect.Value) any {
+	if len(m.pk) == 1 {
+		return m.pk[0].value(entity).Interface()
+	}
+	key := make(Key, len(m.pk))
+	for i, f := range m.pk {
+		key[i] = f.value(entity).Interface()
+	}
+	return key
+}
+
+// keyValues pairs the primary key columns with id, which is a Key for
+// composite keys and a plain value otherwise.
+func (m *model) keyValues(id any) (map[string]any, error) {
+	if len(m.pk) == 0 {
+		return nil, fmt.Errorf("repository: model has no primary key")
+	}
+	key, ok := id.(Key)
+	if !ok {
+		key = Key{id}
+	}
+	if len(key) != len(m.pk) {
+		return nil, fmt.Errorf("repository: key has %d values, want %d", len(key), len(m.pk))
+	}
+	values := map[string]any{}
+	for i, f := range m.pk {
+		values[f.column] = key[i]
+	}
+	return values, nil
+}
+
+// Version returns the optimistic locking version of entity, and false when
+// T has no version column.
+func Version[T any](entity *T) (int, bool) {
+	f := modelOf[T]().version
+	if f == nil {
+		return 0, false
+	}
+	return int(f.value(reflect.ValueOf(entity).Elem()).Int()), true
+}
+
+// SetVersion sets the version that Update expects to find in the database.
+func SetVersion[T any](entity *T, version int) {
+	if f := modelOf[T]().version; f != nil {
+		f.value(reflect.ValueOf(entity).Elem()).SetInt(int64(version))
+	}
+}
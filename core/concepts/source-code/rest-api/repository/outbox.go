@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of the events recorded by repositories with an Outbox. The type of
+// an event is the table followed by its kind, e.g. "users.created".
+const (
+	EventCreated  = "created"
+	EventUpdated  = "updated"
+	EventUpserted = "upserted"
+	EventDeleted  = "deleted"
+	EventRestored = "restored"
+)
+
+// Event is a row of the outbox table. It is written with the change it
+// describes, then delivered at least once by outbox.Dispatcher.
+type Event struct {
+	ID          int64  `json:"id" db:"id,pk,auto"`
+	Type        string `json:"type" db:"type"`
+	Aggregate   string `json:"aggregate" db:"aggregate"`
+	AggregateID string `json:"aggregate_id" db:"aggregate_id"`
+	// Payload is the written entity, or {"id": ...} for deletes and
+	// restores.
+	Payload   RawJSON   `json:"payload" db:"payload"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	Attempts      int        `json:"-" db:"attempts"`
+	NextAttemptAt time.Time  `json:"-" db:"next_attempt_at"`
+	DispatchedAt  *time.Time `json:"-" db:"dispatched_at"`
+	LastError     string     `json:"-" db:"last_error"`
+}
+
+// RawJSON is JSON stored as text and marshalled as is.
+type RawJSON []byte
+
+func (j RawJSON) Value() (driver.Value, error) {
+	return string(j), nil
+}
+
+func (j *RawJSON) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*j = RawJSON(v)
+	case []byte:
+		*j = append(RawJSON{}, v...)
+	case nil:
+		*j = nil
+	default:
+		return fmt.Errorf("raw json: cannot scan %T", src)
+	}
+	return nil
+}
+
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *RawJSON) UnmarshalJSON(data []byte) error {
+	*j = append(RawJSON{}, data...)
+	return nil
+}
+
+// Outbox is where repositories record their events.
+type Outbox struct {
+	// Table defaults to "outbox".
+	Table string
+}
+
+// TableName returns Table or its default.
+func (o Outbox) TableName() string {
+	if o.Table == "" {
+		return "outbox"
+	}
+	return o.Table
+}
+
+// Events returns the repository of the outbox rows in db.
+func (o Outbox) Events(db DBTX) *SQLRepository[Event] {
+	return &SQLRepository[Event]{DB: db, Table: o.TableName()}
+}
+
+// record appends the event of a write of kind to the outbox, through r.DB so
+// that it commits or rolls back with the write.
+func (r *SQLRepository[T]) record(ctx context.Context, kind string, id any, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := now()
+	event := Event{
+		Type:          r.Table + "." + kind,
+		Aggregate:     r.Table,
+		AggregateID:   fmt.Sprint(id),
+		Payload:       data,
+		NextAttemptAt: now,
+	}
+	events := r.Outbox.Events(r.DB)
+	events.Observer = r.Observer
+	return events.Create(ctx, &event)
+}
+
+// write runs fn in a transaction when events are recorded and r is not
+// already bound to one.
+func (r *SQLRepository[T]) write(ctx context.Context, fn func(r *SQLRepository[T]) error) error {
+	db, ok := r.DB.(*sqlx.DB)
+	if r.Outbox == nil || !ok {
+		return fn(r)
+	}
+	return UnitOfWork{DB: db}.WithTx(ctx, func(tx *Tx) error {
+		return fn(r.InTx(tx))
+	})
+}
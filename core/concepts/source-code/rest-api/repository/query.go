@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+type Op string
+
+const (
+	OpEq   Op = "eq"
+	OpNe   Op = "ne"
+	OpIn   Op = "in"
+	OpLike Op = "like"
+	OpGt   Op = "gt"
+	OpGte  Op = "gte"
+	OpLt   Op = "lt"
+	OpLte  Op = "lte"
+)
+
+type Filter struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query describes a filtered, sorted page of results. Pages are walked with
+// opaque keyset cursors rather than offsets.
+type Query struct {
+	Filters []Filter
+	Sorts   []Sort
+	Limit   int
+	Cursor  string
+	// IncludeDeleted also returns soft-deleted rows.
+	IncludeDeleted bool
+
+	// AllowedFilters and AllowedSorts whitelist the columns a client may use.
+	AllowedFilters []string
+	AllowedSorts   []string
+}
+
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 100
+)
+
+func (q Query) validate() error {
+	for _, f := range q.Filters {
+		if !contains(q.AllowedFilters, f.Field) {
+			return fmt.Errorf("%w: filter on %q is not allowed", ErrInvalidQuery, f.Field)
+		}
+		switch f.Op {
+		case OpEq, OpNe, OpIn, OpLike, OpGt, OpGte, OpLt, OpLte:
+		default:
+			return fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, f.Op)
+		}
+	}
+	for _, s := range q.Sorts {
+		if !contains(q.AllowedSorts, s.Field) {
+			return fmt.Errorf("%w: sort on %q is not allowed", ErrInvalidQuery, s.Field)
+		}
+	}
+	return nil
+}
+
+// typed converts the string values of filters to the Go type of their
+// column, so that numbers, booleans and times compare as such in every
+// database. Values of other types are left as they are.
+func (m *model) typed(filters []Filter) ([]Filter, error) {
+	out := make([]Filter, len(filters))
+	for i, f := range filters {
+		out[i] = f
+		field := m.field(f.Field)
+		if field == nil {
+			continue
+		}
+		typ := field.typ
+		if typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+		}
+		if f.Op == OpLike && typ.Kind() != reflect.String {
+			return nil, fmt.Errorf("%w: like only applies to text fields, not %q", ErrInvalidQuery, f.Field)
+		}
+		switch v := f.Value.(type) {
+		case string:
+			value, err := parseValue(v, typ)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not a valid %s", ErrInvalidQuery, v, f.Field)
+			}
+			out[i].Value = value
+		case []string:
+			values := make([]any, len(v))
+			for j, s := range v {
+				value, err := parseValue(s, typ)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %q is not a valid %s", ErrInvalidQuery, s, f.Field)
+				}
+				values[j] = value
+			}
+			out[i].Value = values
+		}
+	}
+	return out, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// parseValue parses s as a value of typ. Times are RFC 3339.
+func parseValue(s string, typ reflect.Type) (any, error) {
+	v := reflect.New(typ).Elem()
+	switch {
+	case typ == timeType:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC(), nil
+	case typ.Kind() == reflect.String:
+		v.SetString(s)
+	case typ.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, typ.Bits())
+		if err != nil {
+			return nil, err
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(s, 10, typ.Bits())
+		if err != nil {
+			return nil, err
+		}
+		v.SetUint(n)
+	case v.CanFloat():
+		n, err := strconv.ParseFloat(s, typ.Bits())
+		if err != nil {
+			return nil, err
+		}
+		v.SetFloat(n)
+	default:
+		return nil, fmt.Errorf("cannot filter on %s", typ)
+	}
+	return v.Interface(), nil
+}
+
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// orderBy returns the requested sorts followed by the primary key columns
+// not sorted on yet, so that the keyset is always unique.
+func (q Query) orderBy(pk []string) []Sort {
+	sorts := append([]Sort{}, q.Sorts...)
+	for _, c := range pk {
+		seen := false
+		for _, s := range q.Sorts {
+			seen = seen || s.Field == c
+		}
+		if !seen {
+			sorts = append(sorts, Sort{Field: c})
+		}
+	}
+	return sorts
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns with '!', which unlike
+// a backslash needs no escaping in the string literals of any database.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (f Filter) toSql() sq.Sqlizer {
+	switch f.Op {
+	case OpNe:
+		return sq.NotEq{f.Field: f.Value}
+	case OpIn:
+		return sq.Eq{f.Field: f.Value}
+	case OpLike:
+		return sq.Expr(f.Field+" LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(fmt.Sprint(f.Value))+"%")
+	case OpGt:
+		return sq.Gt{f.Field: f.Value}
+	case OpGte:
+		return sq.GtOrEq{f.Field: f.Value}
+	case OpLt:
+		return sq.Lt{f.Field: f.Value}
+	case OpLte:
+		return sq.LtOrEq{f.Field: f.Value}
+	}
+	return sq.Eq{f.Field: f.Value}
+}
+
+// keyset builds the "after cursor" predicate for a multi-column ordering:
+// (a > x) OR (a = x AND b > y) OR ...
+func keyset(sorts []Sort, values []any) sq.Sqlizer {
+	or := sq.Or{}
+	for i, s := range sorts {
+		and := sq.And{}
+		for j := 0; j < i; j++ {
+			and = append(and, sq.Eq{sorts[j].Field: values[j]})
+		}
+		if s.Desc {
+			and = append(and, sq.Lt{s.Field: values[i]})
+		} else {
+			and = append(and, sq.Gt{s.Field: values[i]})
+		}
+		or = append(or, and)
+	}
+	return or
+}
+
+// keysetCursor holds the values of the last row of a page, and the sort
+// they were read for, since they only make sense with it.
+type keysetCursor struct {
+	Sort   string            `json:"sort"`
+	Values []json.RawMessage `json:"values"`
+}
+
+// sortSpec renders sorts like the sort query parameter.
+func sortSpec(sorts []Sort) string {
+	fields := make([]string, len(sorts))
+	for i, s := range sorts {
+		fields[i] = s.Field
+		if s.Desc {
+			fields[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func encodeCursor(sorts []Sort, values []any) (string, error) {
+	c := keysetCursor{Sort: sortSpec(sorts), Values: make([]json.RawMessage, len(values))}
+	for i, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		c.Values[i] = b
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor reads a cursor back into values typed like the sorted
+// fields, so that times and numbers compare correctly in every database.
+// A cursor read for another sort is rejected.
+func (m *model) decodeCursor(cursor string, sorts []Sort) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c keysetCursor
+	if err := json.Unmarshal(b, &c); err != nil || len(c.Values) != len(sorts) {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != sortSpec(sorts) {
+		return nil, fmt.Errorf("%w: the cursor belongs to another sort", ErrInvalidQuery)
+	}
+	values := make([]any, len(sorts))
+	for i, s := range sorts {
+		f := m.field(s.Field)
+		if f == nil {
+			return nil, fmt.Errorf("%w: unknown sort column %q", ErrInvalidQuery, s.Field)
+		}
+		v := reflect.New(f.typ)
+		if err := json.Unmarshal(c.Values[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// cursorValues reads the values of the sorted columns from an entity.
+func (m *model) cursorValues(entity reflect.Value, sorts []Sort) []any {
+	values := make([]any, len(sorts))
+	for i, s := range sorts {
+		if f := m.field(s.Field); f != nil {
+			values[i] = f.value(entity).Interface()
+		}
+	}
+	return values
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package repository
+
+import "context"
+
+// Repository is what the generic handlers need from a store of T.
+// SQLRepository implements it, and so can wrappers around it.
+type Repository[T any] interface {
+	GetByID(ctx context.Context, id any) (*T, error)
+	List(ctx context.Context, q Query) (Page[T], error)
+	Exists(ctx context.Context, filters ...Filter) (bool, error)
+	Create(ctx context.Context, entity *T) error
+	Update(ctx context.Context, id any, entity *T) error
+	UpdateFields(ctx context.Context, id any, fields map[string]any) (*T, error)
+	Delete(ctx context.Context, id any) error
+}
+
+var _ Repository[struct{}] = (*SQLRepository[struct{}])(nil)
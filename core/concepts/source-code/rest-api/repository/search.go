@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Searcher finds the entities of T matching a text, most relevant first.
+// Each database implements it with its own full-text search.
+type Searcher[T any] interface {
+	Search(ctx context.Context, q SearchQuery) (SearchPage[T], error)
+}
+
+// SearchQuery is a page of a search. Ranks are no stable keys, so cursors
+// hold an offset rather than a keyset.
+type SearchQuery struct {
+	Text   string
+	Limit  int
+	Cursor string
+}
+
+// Hit is an entity matching a search. Rank is higher for better matches,
+// and comparable within one search only. Highlights holds the matching
+// fields, by column, HTML-escaped and with the matched terms between
+// HighlightStart and HighlightStop, so that they can be rendered as HTML.
+type Hit[T any] struct {
+	Entity     T                 `json:"entity"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+type SearchPage[T any] struct {
+	Data       []Hit[T] `json:"data"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+const (
+	HighlightStart = "<mark>"
+	HighlightStop  = "</mark>"
+)
+
+// Searchers have the database delimit the matches with MatchStart and
+// MatchStop, private use characters that stand out from the data, and pass
+// the text to Highlight.
+const (
+	MatchStart = "\uE000"
+	MatchStop  = "\uE001"
+)
+
+var highlighter = strings.NewReplacer(MatchStart, HighlightStart, MatchStop, HighlightStop)
+
+// Highlight HTML-escapes text and marks the matches delimited by MatchStart
+// and MatchStop. It returns false when text has no match.
+func Highlight(text string) (string, bool) {
+	if !strings.Contains(text, MatchStart) {
+		return "", false
+	}
+	return highlighter.Replace(html.EscapeString(text)), true
+}
+
+// Bounds returns the rows of the page q asks for, with the limits of List.
+// Searchers fetch limit+1 rows from offset and pass them to NewSearchPage.
+func (q SearchQuery) Bounds() (limit, offset int, err error) {
+	limit = Query{Limit: q.Limit}.limit()
+	if q.Cursor == "" {
+		return limit, 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &offset)
+	}
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return limit, offset, nil
+}
+
+// NewSearchPage returns the page of the hits fetched for Bounds, setting the
+// cursor of the next page when there is one more hit than limit.
+func NewSearchPage[T any](hits []Hit[T], limit, offset int) SearchPage[T] {
+	page := SearchPage[T]{Data: hits}
+	if page.Data == nil {
+		page.Data = []Hit[T]{}
+	}
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		b, _ := json.Marshal(offset + limit)
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return page
+}
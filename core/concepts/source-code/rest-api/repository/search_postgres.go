@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PostgresSearch searches the live rows of Repo with PostgreSQL full-text
+// search, ranked by ts_rank_cd, and with the pg_trgm similarity of Columns,
+// so that misspelt words still match. The table needs a tsvector column and
+// the pg_trgm extension, see migration 0008.
+type PostgresSearch[T any] struct {
+	Repo *SQLRepository[T]
+	// Columns are matched by similarity and highlighted.
+	Columns []string
+	// Vector is the tsvector column, search_vector by default, built with
+	// the text search configuration Config, simple by default.
+	Vector, Config string
+}
+
+var _ Searcher[struct{}] = PostgresSearch[struct{}]{}
+
+const headlineOptions = `StartSel="` + MatchStart + `", StopSel="` + MatchStop + `", HighlightAll=true`
+
+func (s PostgresSearch[T]) Search(ctx context.Context, q SearchQuery) (SearchPage[T], error) {
+	r := s.Repo
+	ctx, done := r.begin(ctx, "Search")
+	defer done()
+
+	limit, offset, err := q.Bounds()
+	if err != nil {
+		return SearchPage[T]{}, r.classify(err, nil)
+	}
+	vector, config := s.Vector, s.Config
+	if vector == "" {
+		vector = "search_vector"
+	}
+	if config == "" {
+		config = "simple"
+	}
+
+	// $1 is the text, $2 the configuration and $3 the headline options.
+	m := modelOf[T]()
+	var selects, similar, where []string
+	for _, c := range m.columns() {
+		selects = append(selects, "t."+r.col(c))
+	}
+	rank := "ts_rank_cd(t." + r.col(vector) + ", tsq)"
+	where = append(where, "t."+r.col(vector)+" @@ tsq")
+	for _, c := range s.Columns {
+		similar = append(similar, "similarity(t."+r.col(c)+"::text, $1)")
+		where = append(where, "t."+r.col(c)+"::text % $1")
+	}
+	if len(similar) > 0 {
+		rank += " + greatest(" + strings.Join(similar, ", ") + ")"
+	}
+	selects = append(selects, rank+" AS search_rank")
+	for _, c := range s.Columns {
+		selects = append(selects, "ts_headline($2::regconfig, coalesce(t."+r.col(c)+"::text, ''), tsq, $3)")
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s t, websearch_to_tsquery($2::regconfig, $1) tsq WHERE (%s)",
+		strings.Join(selects, ", "), r.table(), strings.Join(where, " OR "))
+	if m.deletedAt != nil {
+		query += " AND t." + r.col(m.deletedAt.column) + " IS NULL"
+	}
+	order := []string{"search_rank DESC"}
+	for _, c := range m.pkColumns() {
+		order = append(order, "t."+r.col(c))
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d OFFSET %d", strings.Join(order, ", "), limit+1, offset)
+
+	rows, err := r.DB.QueryxContext(ctx, query, q.Text, config, headlineOptions)
+	if err != nil {
+		return SearchPage[T]{}, err
+	}
+	defer rows.Close()
+	var hits []Hit[T]
+	for rows.Next() {
+		var hit Hit[T]
+		entity := reflect.ValueOf(&hit.Entity).Elem()
+		dest := make([]any, 0, len(m.fields)+1+len(s.Columns))
+		for _, f := range m.fields {
+			dest = append(dest, f.value(entity).Addr().Interface())
+		}
+		dest = append(dest, &hit.Rank)
+		highlights := make([]sql.NullString, len(s.Columns))
+		for i := range highlights {
+			dest = append(dest, &highlights[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return SearchPage[T]{}, err
+		}
+		for i, h := range highlights {
+			marked, ok := Highlight(h.String)
+			if !ok {
+				continue
+			}
+			if hit.Highlights == nil {
+				hit.Highlights = map[string]string{}
+			}
+			hit.Highlights[s.Columns[i]] = marked
+		}
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return SearchPage[T]{}, err
+	}
+	return NewSearchPage(hits, limit, offset), nil
+}
@@ -1,79 +1,660 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"rest-api/apperr"
 
 	sq "github.com/Masterminds/squirrel"
-	"github.com/jmoiron/sqlx"
 )
 
+// ErrVersionConflict is wrapped in the Conflict returned by Update when the
+// entity was changed since it was read.
+var ErrVersionConflict = errors.New("version conflict")
+
+// DefaultTimeout bounds the queries of repositories with no Timeout set,
+// unless their context carries one, see WithQueryTimeout.
+const DefaultTimeout = 5 * time.Second
+
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout sets the timeout of the queries run with ctx by
+// repositories with no Timeout set, e.g. from the configuration.
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, d)
+}
+
+// Observer is told about every repository call, e.g. to trace and time it.
+// Observe returns the context the call runs in and a func called when the
+// call returns.
+type Observer interface {
+	Observe(ctx context.Context, table, op string) (context.Context, func())
+}
+
+// DefaultObserver observes the repositories with no Observer set. It is
+// nil, observing nothing, unless the application installs one at startup.
+var DefaultObserver Observer
+
 type SQLRepository[T any] struct {
-	DB    *sqlx.DB
-	Table string
+	DB      DBTX
+	Table   string
+	Timeout time.Duration
+	// Dialect defaults to the one matching the driver of DB.
+	Dialect Dialect
+	// Observer defaults to DefaultObserver.
+	Observer Observer
+	// Outbox, when set, records an Event for each write in the transaction
+	// of the write.
+	Outbox *Outbox
+}
+
+// begin bounds the call op with the timeout and reports it to the observer.
+// The returned func must be called once the call is done.
+func (r *SQLRepository[T]) begin(ctx context.Context, op string) (context.Context, func()) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout, _ = ctx.Value(queryTimeoutKey{}).(time.Duration)
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	end := func() {}
+	if obs := r.observer(); obs != nil {
+		ctx, end = obs.Observe(ctx, r.Table, op)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		end()
+	}
+}
+
+func (r *SQLRepository[T]) observer() Observer {
+	if r.Observer != nil {
+		return r.Observer
+	}
+	return DefaultObserver
+}
+
+func (r *SQLRepository[T]) dialect() Dialect {
+	if r.Dialect != nil {
+		return r.Dialect
+	}
+	return DialectFor(r.DB.DriverName())
+}
+
+func (r *SQLRepository[T]) table() string {
+	return r.dialect().Quote(r.Table)
+}
+
+func (r *SQLRepository[T]) col(name string) string {
+	return r.dialect().Quote(name)
 }
 
-func (r *SQLRepository[T]) GetByID(id int) (*T, error) {
+// selectList is the explicit, quoted column list of T.
+func (r *SQLRepository[T]) selectList() string {
+	columns := modelOf[T]().columns()
+	for i, c := range columns {
+		columns[i] = r.col(c)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// quoteKeys quotes the column names of a values map for squirrel.
+func (r *SQLRepository[T]) quoteKeys(values map[string]any) map[string]any {
+	quoted := make(map[string]any, len(values))
+	for c, v := range values {
+		quoted[r.col(c)] = v
+	}
+	return quoted
+}
+
+// where matches the row with primary key id, skipping soft-deleted rows
+// unless withDeleted is set.
+func (r *SQLRepository[T]) where(id any, withDeleted bool) (sq.Eq, error) {
+	m := modelOf[T]()
+	values, err := m.keyValues(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.deletedAt != nil && !withDeleted {
+		values[m.deletedAt.column] = nil
+	}
+	return sq.Eq(r.quoteKeys(values)), nil
+}
+
+// live excludes soft-deleted rows from a SELECT.
+func (r *SQLRepository[T]) live(builder sq.SelectBuilder) sq.SelectBuilder {
+	if f := modelOf[T]().deletedAt; f != nil {
+		return builder.Where(sq.Eq{r.col(f.column): nil})
+	}
+	return builder
+}
+
+// classify turns database errors into domain errors: a missing row becomes
+// NotFound, a broken unique constraint or a stale version Conflict and an
+// invalid query BadRequest. The original error stays in the chain.
+func (r *SQLRepository[T]) classify(err error, id any) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return apperr.NotFound(fmt.Sprintf("%s %v not found", r.Table, id), err)
+	case errors.Is(err, ErrVersionConflict):
+		return apperr.Conflict(fmt.Sprintf("%s %v was modified", r.Table, id), err)
+	case errors.Is(err, ErrInvalidQuery):
+		return apperr.BadRequest(err.Error(), err)
+	case r.dialect().IsUniqueViolation(err):
+		return apperr.Conflict(fmt.Sprintf("%s: a unique value is already taken", r.Table), err)
+	}
+	return err
+}
+
+// now is the audit timestamp, truncated to what every database stores.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (r *SQLRepository[T]) reload(ctx context.Context, entity *T, id any) error {
+	where, err := r.where(id, false)
+	if err != nil {
+		return err
+	}
+	query, args, err := sq.Select(r.selectList()).From(r.table()).Where(where).
+		PlaceholderFormat(r.dialect().Placeholder()).ToSql()
+	if err != nil {
+		return err
+	}
+	return r.DB.GetContext(ctx, entity, query, args...)
+}
+
+// GetByID loads one row. id is a Key when the primary key is composite.
+func (r *SQLRepository[T]) GetByID(ctx context.Context, id any) (*T, error) {
+	ctx, done := r.begin(ctx, "GetByID")
+	defer done()
+
 	var t T
-	query := fmt.Sprintf("SELECT * FROM %s WHERE id = $1", r.Table)
-	err := r.DB.Get(&t, query, id)
-	return &t, err
+	err := r.reload(ctx, &t, id)
+	return &t, r.classify(err, id)
+}
+
+// Exists reports whether a live row matches every filter. Filters are not
+// checked against a whitelist, so they must not come from the client as is.
+func (r *SQLRepository[T]) Exists(ctx context.Context, filters ...Filter) (bool, error) {
+	ctx, done := r.begin(ctx, "Exists")
+	defer done()
+
+	builder := r.live(sq.Select("1").From(r.table())).Limit(1).
+		PlaceholderFormat(r.dialect().Placeholder())
+	for _, f := range filters {
+		f.Field = r.col(f.Field)
+		builder = builder.Where(f.toSql())
+	}
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return false, err
+	}
+	var found int
+	err = r.DB.GetContext(ctx, &found, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-func (r *SQLRepository[T]) ListPaginated(limit, offset int) ([]T, error) {
+func (r *SQLRepository[T]) ListPaginated(ctx context.Context, limit, offset int) ([]T, error) {
+	ctx, done := r.begin(ctx, "ListPaginated")
+	defer done()
+
 	var items []T
-	query := fmt.Sprintf("SELECT * FROM %s ORDER BY id LIMIT $1 OFFSET $2", r.Table)
-	err := r.DB.Select(&items, query, limit, offset)
+	builder := r.live(sq.Select(r.selectList()).From(r.table())).
+		Limit(uint64(limit)).Offset(uint64(offset)).
+		PlaceholderFormat(r.dialect().Placeholder())
+	for _, c := range modelOf[T]().pkColumns() {
+		builder = builder.OrderBy(r.col(c))
+	}
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	err = r.DB.SelectContext(ctx, &items, query, args...)
 	return items, err
 }
 
-func (r *SQLRepository[T]) Create(entity *T) error {
-	val := reflect.Indirect(reflect.ValueOf(entity))
-	typ := val.Type()
+func (r *SQLRepository[T]) Create(ctx context.Context, entity *T) error {
+	return r.write(ctx, func(r *SQLRepository[T]) error {
+		if err := r.create(ctx, entity); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventCreated, modelOf[T]().key(reflect.ValueOf(entity).Elem()), entity)
+	})
+}
+
+func (r *SQLRepository[T]) create(ctx context.Context, entity *T) error {
+	ctx, done := r.begin(ctx, "Create")
+	defer done()
+
+	m := modelOf[T]()
+	val := reflect.ValueOf(entity).Elem()
+	// The database generates the key: one set by the caller is not
+	// written, and must not be used to read the row back either.
+	if f := m.autoPK(); f != nil {
+		f.value(val).SetZero()
+	}
+	m.touch(val, now(), true)
+	values := m.insertValues(val, false)
+	insert := sq.Insert(r.table()).SetMap(r.quoteKeys(values)).PlaceholderFormat(r.dialect().Placeholder())
+	return r.classify(r.insert(ctx, entity, insert), nil)
+}
+
+// Upsert inserts entity, or updates the writable columns of the existing row
+// with the same primary key. It does not check or bump versions.
+func (r *SQLRepository[T]) Upsert(ctx context.Context, entity *T) error {
+	return r.write(ctx, func(r *SQLRepository[T]) error {
+		if err := r.upsert(ctx, entity); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventUpserted, modelOf[T]().key(reflect.ValueOf(entity).Elem()), entity)
+	})
+}
+
+func (r *SQLRepository[T]) upsert(ctx context.Context, entity *T) error {
+	ctx, done := r.begin(ctx, "Upsert")
+	defer done()
+
+	m := modelOf[T]()
+	val := reflect.ValueOf(entity).Elem()
+	m.touch(val, now(), true)
+	var columns []string
+	for c := range m.updateValues(val) {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	insert := sq.Insert(r.table()).SetMap(r.quoteKeys(m.insertValues(val, true))).
+		Suffix(r.dialect().Upsert(m.pkColumns(), columns)).
+		PlaceholderFormat(r.dialect().Placeholder())
+	return r.classify(r.insert(ctx, entity, insert), m.key(val))
+}
 
-	values := map[string]interface{}{}
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
-		dbTag := field.Tag.Get("db")
-		if dbTag == "" || dbTag == "-" || dbTag == "id" {
-			continue
+// insert runs an INSERT and reads the written row back into entity, with
+// RETURNING when the dialect has it, otherwise by LastInsertId for a zero
+// auto key and by the key of entity for any other.
+func (r *SQLRepository[T]) insert(ctx context.Context, entity *T, insert sq.InsertBuilder) error {
+	if r.dialect().Returning() {
+		query, args, err := insert.Suffix("RETURNING " + r.selectList()).ToSql()
+		if err != nil {
+			return err
 		}
-		values[dbTag] = val.Field(i).Interface()
+		return r.DB.GetContext(ctx, entity, query, args...)
 	}
 
-	query, args, err := sq.Insert(r.Table).SetMap(values).PlaceholderFormat(sq.Dollar).ToSql()
+	query, args, err := insert.ToSql()
 	if err != nil {
 		return err
 	}
-	_, err = r.DB.Exec(query, args...)
-	return err
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	m := modelOf[T]()
+	val := reflect.ValueOf(entity).Elem()
+	if f := m.autoPK(); f != nil && f.value(val).IsZero() {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return r.reload(ctx, entity, id)
+	}
+	return r.reload(ctx, entity, m.key(val))
+}
+
+// Update writes entity to the row with primary key id. When T has a version
+// column the write only succeeds if entity still holds the stored version;
+// otherwise a Conflict wrapping ErrVersionConflict is returned and nothing
+// changes.
+func (r *SQLRepository[T]) Update(ctx context.Context, id any, entity *T) error {
+	return r.write(ctx, func(r *SQLRepository[T]) error {
+		if err := r.update(ctx, id, entity); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventUpdated, id, entity)
+	})
 }
 
-func (r *SQLRepository[T]) Update(id int, entity *T) error {
-	val := reflect.Indirect(reflect.ValueOf(entity))
-	typ := val.Type()
-	values := map[string]interface{}{}
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
-		dbTag := field.Tag.Get("db")
-		if dbTag == "" || dbTag == "-" || dbTag == "id" {
-			continue
+func (r *SQLRepository[T]) update(ctx context.Context, id any, entity *T) error {
+	ctx, done := r.begin(ctx, "Update")
+	defer done()
+
+	where, err := r.where(id, false)
+	if err != nil {
+		return err
+	}
+	m := modelOf[T]()
+	val := reflect.ValueOf(entity).Elem()
+	m.touch(val, now(), false)
+	update := sq.Update(r.table()).SetMap(r.quoteKeys(m.updateValues(val))).
+		PlaceholderFormat(r.dialect().Placeholder())
+	if f := m.version; f != nil {
+		where[r.col(f.column)] = f.value(val).Interface()
+		update = update.Set(r.col(f.column), sq.Expr(r.col(f.column)+" + 1"))
+	}
+	update = update.Where(where)
+
+	if r.dialect().Returning() {
+		query, args, err := update.Suffix("RETURNING " + r.selectList()).ToSql()
+		if err != nil {
+			return err
+		}
+		err = r.DB.GetContext(ctx, entity, query, args...)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = r.missing(ctx, id)
 		}
-		values[dbTag] = val.Field(i).Interface()
+		return r.classify(err, id)
 	}
-	query, args, err := sq.Update(r.Table).SetMap(values).Where(sq.Eq{"id": id}).PlaceholderFormat(sq.Dollar).ToSql()
+
+	query, args, err := update.ToSql()
 	if err != nil {
 		return err
 	}
-	_, err = r.DB.Exec(query, args...)
-	return err
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return r.classify(err, id)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return r.classify(r.missing(ctx, id), id)
+	}
+	return r.classify(r.reload(ctx, entity, id), id)
+}
+
+// UpdateFields sets only the given columns of the row with primary key id
+// and returns the updated row. Columns must be writable; updated_at is
+// stamped and the version bumped as by Update. When T has a version column,
+// fields must hold it: the write then only succeeds if the row still has
+// that version, and the version itself is not written.
+func (r *SQLRepository[T]) UpdateFields(ctx context.Context, id any, fields map[string]any) (*T, error) {
+	var entity *T
+	err := r.write(ctx, func(r *SQLRepository[T]) error {
+		var err error
+		if entity, err = r.updateFields(ctx, id, fields); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventUpdated, id, entity)
+	})
+	return entity, err
+}
+
+// UpdateFieldsWhere is UpdateFields on a row that also matches every
+// filter, checked by the UPDATE itself so that no concurrent write slips in
+// between. A row that does not match is NotFound. Filters are not checked
+// against a whitelist, so they must not come from the client as is.
+func (r *SQLRepository[T]) UpdateFieldsWhere(ctx context.Context, id any, fields map[string]any, filters ...Filter) (*T, error) {
+	var entity *T
+	err := r.write(ctx, func(r *SQLRepository[T]) error {
+		var err error
+		if entity, err = r.updateFields(ctx, id, fields, filters...); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventUpdated, id, entity)
+	})
+	return entity, err
+}
+
+func (r *SQLRepository[T]) updateFields(ctx context.Context, id any, fields map[string]any, filters ...Filter) (*T, error) {
+	ctx, done := r.begin(ctx, "UpdateFields")
+	defer done()
+
+	where, err := r.where(id, false)
+	if err != nil {
+		return nil, err
+	}
+	conds := sq.And{where}
+	for _, f := range filters {
+		f.Field = r.col(f.Field)
+		conds = append(conds, f.toSql())
+	}
+	m := modelOf[T]()
+	values := map[string]any{}
+	for c, v := range fields {
+		f := m.field(c)
+		switch {
+		case f != nil && f == m.version:
+			where[r.col(c)] = v
+		case f == nil || !m.writable(f):
+			return nil, r.classify(fmt.Errorf("%w: column %q cannot be updated", ErrInvalidQuery, c), id)
+		default:
+			values[c] = v
+		}
+	}
+	if f := m.version; f != nil {
+		if _, ok := fields[f.column]; !ok {
+			return nil, fmt.Errorf("repository: UpdateFields on %s needs the expected version", r.Table)
+		}
+	}
+	if f := m.updatedAt; f != nil {
+		values[f.column] = now()
+	}
+	if len(values) == 0 && m.version == nil && len(filters) == 0 {
+		return r.GetByID(ctx, id)
+	}
+	update := sq.Update(r.table()).SetMap(r.quoteKeys(values)).Where(conds).
+		PlaceholderFormat(r.dialect().Placeholder())
+	if f := m.version; f != nil {
+		update = update.Set(r.col(f.column), sq.Expr(r.col(f.column)+" + 1"))
+	}
+
+	var entity T
+	if r.dialect().Returning() {
+		query, args, err := update.Suffix("RETURNING " + r.selectList()).ToSql()
+		if err != nil {
+			return nil, err
+		}
+		err = r.DB.GetContext(ctx, &entity, query, args...)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = r.missing(ctx, id)
+		}
+		return &entity, r.classify(err, id)
+	}
+
+	query, args, err := update.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, r.classify(err, id)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, r.classify(r.missing(ctx, id), id)
+	}
+	return &entity, r.classify(r.reload(ctx, &entity, id), id)
+}
+
+// missing explains why a conditional write matched no row: the row is gone
+// (sql.ErrNoRows) or its version moved on (ErrVersionConflict).
+func (r *SQLRepository[T]) missing(ctx context.Context, id any) error {
+	if modelOf[T]().version == nil {
+		return sql.ErrNoRows
+	}
+	var current T
+	if err := r.reload(ctx, &current, id); err != nil {
+		return err
+	}
+	return ErrVersionConflict
 }
 
-func (r *SQLRepository[T]) Delete(id int) error {
-	query, args, err := sq.Delete(r.Table).Where(sq.Eq{"id": id}).PlaceholderFormat(sq.Dollar).ToSql()
+// Delete soft-deletes the row when T has a deleted_at column and removes it
+// otherwise.
+func (r *SQLRepository[T]) Delete(ctx context.Context, id any) error {
+	return r.write(ctx, func(r *SQLRepository[T]) error {
+		if err := r.remove(ctx, id, false); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventDeleted, id, map[string]any{"id": id})
+	})
+}
+
+// HardDelete removes the row, soft-deleted or not.
+func (r *SQLRepository[T]) HardDelete(ctx context.Context, id any) error {
+	return r.write(ctx, func(r *SQLRepository[T]) error {
+		if err := r.remove(ctx, id, true); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventDeleted, id, map[string]any{"id": id})
+	})
+}
+
+// remove soft-deletes the row when T has a deleted_at column and hard is
+// false, and removes it otherwise. It returns a NotFound error wrapping
+// sql.ErrNoRows when no row was affected.
+func (r *SQLRepository[T]) remove(ctx context.Context, id any, hard bool) error {
+	f := modelOf[T]().deletedAt
+	op := "Delete"
+	if f == nil || hard {
+		op = "HardDelete"
+	}
+	ctx, done := r.begin(ctx, op)
+	defer done()
+
+	where, err := r.where(id, op == "HardDelete")
 	if err != nil {
 		return err
 	}
-	_, err = r.DB.Exec(query, args...)
-	return err
+	var query string
+	var args []any
+	if op == "HardDelete" {
+		query, args, err = sq.Delete(r.table()).Where(where).
+			PlaceholderFormat(r.dialect().Placeholder()).ToSql()
+	} else {
+		query, args, err = sq.Update(r.table()).Set(r.col(f.column), now()).Where(where).
+			PlaceholderFormat(r.dialect().Placeholder()).ToSql()
+	}
+	if err != nil {
+		return err
+	}
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return r.classify(sql.ErrNoRows, id)
+	}
+	return nil
+}
+
+// Restore undoes a soft delete. It returns a NotFound error wrapping
+// sql.ErrNoRows when no deleted row has that id.
+func (r *SQLRepository[T]) Restore(ctx context.Context, id any) error {
+	return r.write(ctx, func(r *SQLRepository[T]) error {
+		if err := r.restore(ctx, id); err != nil || r.Outbox == nil {
+			return err
+		}
+		return r.record(ctx, EventRestored, id, map[string]any{"id": id})
+	})
+}
+
+func (r *SQLRepository[T]) restore(ctx context.Context, id any) error {
+	f := modelOf[T]().deletedAt
+	if f == nil {
+		return fmt.Errorf("repository: %s has no deleted_at column", r.Table)
+	}
+
+	ctx, done := r.begin(ctx, "Restore")
+	defer done()
+
+	where, err := r.where(id, true)
+	if err != nil {
+		return err
+	}
+	query, args, err := sq.Update(r.table()).Set(r.col(f.column), nil).
+		Where(where).Where(sq.NotEq{r.col(f.column): nil}).
+		PlaceholderFormat(r.dialect().Placeholder()).ToSql()
+	if err != nil {
+		return err
+	}
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return r.classify(sql.ErrNoRows, id)
+	}
+	return nil
+}
+
+func (r *SQLRepository[T]) List(ctx context.Context, q Query) (Page[T], error) {
+	ctx, done := r.begin(ctx, "List")
+	defer done()
+
+	page := Page[T]{Data: []T{}}
+	if err := q.validate(); err != nil {
+		return page, r.classify(err, nil)
+	}
+	m := modelOf[T]()
+	filters, err := m.typed(q.Filters)
+	if err != nil {
+		return page, r.classify(err, nil)
+	}
+	sorts := q.orderBy(m.pkColumns())
+	limit := q.limit()
+
+	builder := sq.Select(r.selectList()).From(r.table()).PlaceholderFormat(r.dialect().Placeholder())
+	if !q.IncludeDeleted {
+		builder = r.live(builder)
+	}
+	for _, f := range filters {
+		f.Field = r.col(f.Field)
+		builder = builder.Where(f.toSql())
+	}
+	if q.Cursor != "" {
+		values, err := m.decodeCursor(q.Cursor, sorts)
+		if err != nil {
+			return page, r.classify(err, nil)
+		}
+		builder = builder.Where(keyset(r.quoted(sorts), values))
+	}
+	for _, s := range r.quoted(sorts) {
+		if s.Desc {
+			builder = builder.OrderBy(s.Field + " DESC")
+		} else {
+			builder = builder.OrderBy(s.Field)
+		}
+	}
+	// Fetch one extra row to know whether another page follows.
+	builder = builder.Limit(uint64(limit + 1))
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return page, err
+	}
+	if err := r.DB.SelectContext(ctx, &page.Data, query, args...); err != nil {
+		return page, err
+	}
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		cursor, err := encodeCursor(sorts, m.cursorValues(reflect.ValueOf(&page.Data[limit-1]).Elem(), sorts))
+		if err != nil {
+			return page, err
+		}
+		page.NextCursor = cursor
+	}
+	return page, nil
+}
+
+func (r *SQLRepository[T]) quoted(sorts []Sort) []Sort {
+	out := make([]Sort, len(sorts))
+	for i, s := range sorts {
+		out[i] = Sort{Field: r.col(s.Field), Desc: s.Desc}
+	}
+	return out
 }
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DBTX is the subset of sqlx shared by *sqlx.DB and *sqlx.Tx, so a
+// repository can run either inside or outside a transaction.
+type DBTX interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+// UnitOfWork groups several repository calls into one transaction.
+type UnitOfWork struct {
+	DB *sqlx.DB
+}
+
+// Tx is a transaction handed out by WithTx. Nested WithTx calls on a Tx run
+// inside a savepoint.
+type Tx struct {
+	*sqlx.Tx
+	depth int
+}
+
+// WithTx runs fn in a transaction. It commits when fn returns nil and rolls
+// back when fn returns an error or panics.
+func (u UnitOfWork) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	sqlTx, err := u.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	return run(&Tx{Tx: sqlTx}, fn, sqlTx.Commit, sqlTx.Rollback)
+}
+
+// WithTx runs fn inside a savepoint of t. An error or panic only undoes the
+// work done by fn; the enclosing transaction can still commit.
+func (t *Tx) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	name := fmt.Sprintf("sp_%d", t.depth+1)
+	if _, err := t.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	release := func() error {
+		_, err := t.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+	rollback := func() error {
+		_, err := t.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		return err
+	}
+	return run(&Tx{Tx: t.Tx, depth: t.depth + 1}, fn, release, rollback)
+}
+
+func run(tx *Tx, fn func(tx *Tx) error, commit, rollback func() error) error {
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		if rbErr := rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+	return commit()
+}
+
+// InTx returns a copy of the repository bound to tx.
+func (r *SQLRepository[T]) InTx(tx *Tx) *SQLRepository[T] {
+	bound := *r
+	bound.DB = tx.Tx
+	return &bound
+}
@@ -0,0 +1,258 @@
+// Package router mounts the routes of the API and describes each of them in
+// the OpenAPI document served at /openapi.json.
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"rest-api/auth"
+	"rest-api/bulk"
+	"rest-api/crud"
+	"rest-api/handler"
+	"rest-api/middleware"
+	"rest-api/model"
+	"rest-api/openapi"
+	"rest-api/ratelimit"
+	"rest-api/repository"
+	"rest-api/server"
+	"rest-api/telemetry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type Deps struct {
+	DB   *sqlx.DB
+	Keys auth.KeySet
+	// Secret signs the tokens of POST /auth/token, which is only mounted
+	// with IssueTokens. It issues tokens with any roles, for local runs.
+	Secret      []byte
+	IssueTokens bool
+	// Probe answers /healthz and /readyz; one pinging DB is made when nil.
+	Probe *server.Probe
+	// RateLimits keeps the rate limit buckets, in memory by default.
+	RateLimits ratelimit.Store
+	// QueryTimeout bounds the queries of each request, DefaultTimeout of
+	// package repository when zero.
+	QueryTimeout time.Duration
+	// TrustedProxies are the proxies whose X-Forwarded-For sets the client
+	// IP, which keys the anonymous rate limits. None are trusted when empty.
+	TrustedProxies []string
+	// Search answers /users/search, with handler.UserSearch by default.
+	Search repository.Searcher[model.User]
+}
+
+// Rate limit policies, per client. Writes and token issuance are tighter
+// than reads.
+var (
+	ReadLimit  = ratelimit.Policy{Name: "read", Rate: 300, Period: time.Minute, Burst: 60}
+	WriteLimit = ratelimit.Policy{Name: "write", Rate: 60, Period: time.Minute, Burst: 20}
+	TokenLimit = ratelimit.Policy{Name: "token", Rate: 10, Period: time.Minute, Burst: 5}
+)
+
+// New builds the engine with every route mounted.
+func New(d Deps) *gin.Engine {
+	r := gin.Default()
+	if err := r.SetTrustedProxies(d.TrustedProxies); err != nil {
+		panic("router: " + err.Error())
+	}
+	r.Use(telemetry.Tracing(), telemetry.Metrics(), middleware.Errors())
+	if d.QueryTimeout > 0 {
+		r.Use(middleware.QueryTimeout(d.QueryTimeout))
+	}
+	spec := openapi.New("rest-api", "1.0.0")
+	db := d.DB
+	store := d.RateLimits
+	if store == nil {
+		store = &ratelimit.MemoryStore{}
+	}
+	limits := ratelimit.Limiter{Store: store}
+	byIP := ratelimit.Limiter{Store: store, Key: ratelimit.ByIP}
+
+	if d.IssueTokens && len(d.Secret) > 0 {
+		r.POST("/auth/token", byIP.Limit(TokenLimit), handler.IssueToken(auth.Issuer{Issuer: d.Keys.Issuer, Secret: d.Secret, TTL: time.Hour}))
+		spec.Add(http.MethodPost, "/auth/token", openapi.Op{
+			Summary: "Issue a development token", Tags: []string{"auth"},
+			Request: handler.TokenRequest{}, Response: handler.TokenResponse{}, RateLimited: true,
+		})
+	}
+
+	apiKeys := auth.APIKeyStore{Repo: &repository.SQLRepository[model.APIKey]{DB: db, Table: "api_keys"}}
+	authn := auth.Authenticator{Keys: d.Keys, APIKeys: &apiKeys}
+
+	users := []string{"users"}
+	canRead := openapi.Auth{Optional: true, Scopes: []string{auth.ScopeUsersRead}}
+	canWrite := openapi.Auth{Required: true, Scopes: []string{auth.ScopeUsersWrite}}
+	isAdmin := openapi.Auth{Required: true, Scopes: canWrite.Scopes, Roles: []string{"admin"}}
+
+	public := r.Group("/")
+	public.Use(middleware.OptionalAuth(authn), limits.Limit(ReadLimit), middleware.RequireScope(auth.ScopeUsersRead))
+	public.GET("/users", handler.GetUsers(db))
+	spec.Add(http.MethodGet, "/users", openapi.Op{
+		Summary: "List users", Tags: users, RateLimited: true, Auth: canRead,
+		Params: openapi.ListParams(handler.UserFilters, handler.UserSorts), Response: repository.Page[model.User]{},
+		Errors: []int{http.StatusBadRequest},
+	})
+	search := d.Search
+	if search == nil {
+		search = handler.UserSearch(db)
+	}
+	public.GET("/users/search", handler.SearchUsers(search))
+	spec.Add(http.MethodGet, "/users/search", openapi.Op{
+		Summary: "Search users by name and email", Tags: users, RateLimited: true, Auth: canRead,
+		Params: openapi.SearchParams(handler.MaxSearchLength), Response: repository.SearchPage[model.User]{},
+		Errors: []int{http.StatusBadRequest},
+	})
+	public.GET("/users/:id", handler.GetUserByID(db))
+	spec.Add(http.MethodGet, "/users/:id", openapi.Op{
+		Summary: "Get a user", Tags: users, RateLimited: true, Auth: canRead, Response: model.User{}, ETag: true,
+	})
+
+	protected := r.Group("/")
+	protected.Use(middleware.AuthMiddleware(authn), limits.Limit(WriteLimit), middleware.RequireScope(auth.ScopeUsersWrite))
+	protected.POST("/users", handler.CreateUser(db))
+	spec.Add(http.MethodPost, "/users", openapi.Op{
+		Summary: "Create a user", Tags: users, RateLimited: true, Auth: canWrite,
+		Request: model.User{}, Response: model.User{}, Status: http.StatusCreated, Errors: []int{http.StatusConflict},
+	})
+	protected.PUT("/users/:id", handler.UpdateUser(db))
+	spec.Add(http.MethodPut, "/users/:id", openapi.Op{
+		Summary: "Replace a user", Tags: users, RateLimited: true, Auth: canWrite,
+		Request: model.User{}, Response: model.User{}, ETag: true, IfMatch: true,
+	})
+	protected.PATCH("/users/:id", handler.PatchUser(db))
+	spec.Add(http.MethodPatch, "/users/:id", openapi.Op{
+		Summary: "Update fields of a user", Tags: users, RateLimited: true, Auth: canWrite,
+		Request: model.User{}, RequestTypes: crud.PatchTypes, Response: model.User{}, ETag: true, IfMatch: true,
+		Errors: []int{http.StatusConflict, http.StatusUnsupportedMediaType},
+	})
+	protected.DELETE("/users/:id", middleware.RequireRole("admin"), handler.DeleteUser(db))
+	spec.Add(http.MethodDelete, "/users/:id", openapi.Op{
+		Summary: "Delete a user", Tags: users, RateLimited: true, Auth: isAdmin, Response: openapi.Status{},
+	})
+	protected.POST("/users/:id/restore", middleware.RequireRole("admin"), handler.RestoreUser(db))
+	spec.Add(http.MethodPost, "/users/:id/restore", openapi.Op{
+		Summary: "Restore a deleted user", Tags: users, RateLimited: true, Auth: isAdmin, Response: openapi.Status{},
+	})
+
+	// The bulk routes are custom methods, mounted with their own chains so
+	// that Literal runs first.
+	r.POST("/users:import", middleware.Literal(), middleware.AuthMiddleware(authn), limits.Limit(WriteLimit),
+		middleware.RequireScope(auth.ScopeUsersWrite), handler.ImportUsers(db))
+	spec.Add(http.MethodPost, "/users:import", openapi.Op{
+		Summary: "Import users from CSV or NDJSON", Tags: users, RateLimited: true, Auth: canWrite,
+		Request: model.User{}, RequestTypes: bulk.Formats, Response: handler.ImportReport{},
+		Errors: []int{http.StatusUnsupportedMediaType, http.StatusRequestEntityTooLarge},
+	})
+	r.GET("/users:export", middleware.Literal(), middleware.AuthMiddleware(authn), limits.Limit(ReadLimit),
+		middleware.RequireScope(auth.ScopeUsersRead), handler.ExportUsers(db))
+	spec.Add(http.MethodGet, "/users:export", openapi.Op{
+		Summary: "Export users as CSV or NDJSON", Tags: users, RateLimited: true,
+		Auth:     openapi.Auth{Required: true, Scopes: canRead.Scopes},
+		Params:   []openapi.Parameter{{Name: "format", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []any{"csv", "ndjson"}}}},
+		Response: model.User{}, ResponseTypes: bulk.Formats, Errors: []int{http.StatusBadRequest},
+	})
+
+	products := &repository.SQLRepository[model.Product]{DB: db, Table: "products"}
+	write := []gin.HandlerFunc{middleware.AuthMiddleware(authn), limits.Limit(WriteLimit), middleware.RequireScope(auth.ScopeProductsWrite)}
+	productOpts := crud.Options[model.Product]{
+		Name:    "product",
+		Filters: []string{"sku", "name", "price_cents"},
+		Sorts:   []string{"id", "name", "price_cents", "created_at"},
+		Middleware: crud.Middleware{
+			Create: write,
+			Update: write,
+			Patch:  write,
+			Delete: append(write, middleware.RequireRole("admin")),
+		},
+		RateLimited: true,
+	}
+	crud.Register(r.Group("/products", middleware.OptionalAuth(authn), limits.Limit(ReadLimit), middleware.RequireScope(auth.ScopeProductsRead)), products, productOpts)
+	productRead := openapi.Auth{Optional: true, Scopes: []string{auth.ScopeProductsRead}}
+	productWrite := openapi.Auth{Required: true, Scopes: []string{auth.ScopeProductsRead, auth.ScopeProductsWrite}}
+	crud.Describe(spec, "/products", productOpts, crud.Auth{
+		List: productRead, Get: productRead,
+		Create: productWrite, Update: productWrite, Patch: productWrite,
+		Delete: openapi.Auth{Required: true, Scopes: productWrite.Scopes, Roles: []string{"admin"}},
+	})
+
+	hooks := []string{"webhooks"}
+	hookRead := openapi.Auth{Required: true, Scopes: []string{auth.ScopeWebhooksRead}}
+	hookWrite := openapi.Auth{Required: true, Scopes: []string{auth.ScopeWebhooksRead, auth.ScopeWebhooksWrite}}
+	hookOpts := handler.WebhookOptions
+	write = []gin.HandlerFunc{limits.Limit(WriteLimit), middleware.RequireScope(auth.ScopeWebhooksWrite)}
+	own := handler.OwnWebhook(db)
+	hookOpts.Middleware = crud.Middleware{
+		Get:    []gin.HandlerFunc{own},
+		Create: write,
+		Update: append(write, own),
+		Patch:  append(write, own),
+		Delete: append(write, own),
+	}
+	hookOpts.RateLimited = true
+	webhooks := r.Group("/webhooks", middleware.AuthMiddleware(authn), limits.Limit(ReadLimit), middleware.RequireScope(auth.ScopeWebhooksRead))
+	crud.Register(webhooks, &repository.SQLRepository[model.Webhook]{DB: db, Table: "webhooks"}, hookOpts)
+	crud.Describe(spec, "/webhooks", hookOpts, crud.Auth{
+		List: hookRead, Get: hookRead,
+		Create: hookWrite, Update: hookWrite, Patch: hookWrite, Delete: hookWrite,
+	})
+	webhooks.GET("/:id/deliveries", handler.ListWebhookDeliveries(db))
+	spec.Add(http.MethodGet, "/webhooks/:id/deliveries", openapi.Op{
+		Summary: "List the deliveries of a webhook", Tags: hooks, RateLimited: true, Auth: hookRead,
+		Params: openapi.ListParams(handler.DeliveryFilters, handler.DeliverySorts), Response: repository.Page[model.WebhookDelivery]{},
+		Errors: []int{http.StatusBadRequest},
+	})
+	webhooks.POST("/:id/deliveries/:delivery_id/retry", append(write, handler.RetryWebhookDelivery(db))...)
+	spec.Add(http.MethodPost, "/webhooks/:id/deliveries/:delivery_id/retry", openapi.Op{
+		Summary: "Retry a dead delivery", Tags: hooks, RateLimited: true, Auth: hookWrite,
+		Response: model.WebhookDelivery{}, Errors: []int{http.StatusConflict},
+	})
+
+	keys := []string{"api keys"}
+	adminOnly := openapi.Auth{Required: true, Roles: []string{"admin"}}
+	admin := r.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(authn), limits.Limit(WriteLimit), middleware.RequireRole("admin"))
+	admin.GET("/api-keys", handler.ListAPIKeys(db))
+	spec.Add(http.MethodGet, "/admin/api-keys", openapi.Op{
+		Summary: "List API keys", Tags: keys, RateLimited: true, Auth: adminOnly,
+		Params: openapi.ListParams([]string{"name", "prefix"}, []string{"id", "name", "created_at"}), Response: repository.Page[model.APIKey]{},
+		Errors: []int{http.StatusBadRequest},
+	})
+	admin.POST("/api-keys", handler.CreateAPIKey(db))
+	spec.Add(http.MethodPost, "/admin/api-keys", openapi.Op{
+		Summary: "Create an API key", Tags: keys, RateLimited: true, Auth: adminOnly,
+		Request: handler.APIKeyRequest{}, Response: handler.APIKeyResponse{}, Status: http.StatusCreated,
+	})
+	admin.POST("/api-keys/:id/rotate", handler.RotateAPIKey(db))
+	spec.Add(http.MethodPost, "/admin/api-keys/:id/rotate", openapi.Op{
+		Summary: "Replace the secret of an API key", Tags: keys, RateLimited: true, Auth: adminOnly, Response: handler.APIKeyResponse{},
+	})
+	admin.DELETE("/api-keys/:id", handler.RevokeAPIKey(db))
+	spec.Add(http.MethodDelete, "/admin/api-keys/:id", openapi.Op{
+		Summary: "Revoke an API key", Tags: keys, RateLimited: true, Auth: adminOnly, Response: model.APIKey{},
+	})
+
+	probe := d.Probe
+	if probe == nil {
+		probe = &server.Probe{DB: db}
+	}
+	health := []string{"health"}
+	r.GET("/healthz", probe.Live)
+	spec.Add(http.MethodGet, "/healthz", openapi.Op{
+		Summary: "Check that the server is alive", Tags: health, Response: openapi.Status{},
+	})
+	r.GET("/readyz", probe.Ready)
+	spec.Add(http.MethodGet, "/readyz", openapi.Op{
+		Summary: "Check that the server can take traffic", Tags: health, Response: openapi.Status{},
+		Errors: []int{http.StatusServiceUnavailable},
+	})
+
+	r.GET("/metrics", telemetry.Handler())
+	spec.Hide(http.MethodGet, "/metrics")
+	r.GET("/openapi.json", spec.Handler(r))
+	spec.Hide(http.MethodGet, "/openapi.json")
+	r.GET("/docs/*any", openapi.Docs("/openapi.json"))
+	spec.Hide(http.MethodGet, "/docs/*any")
+	return r
+}
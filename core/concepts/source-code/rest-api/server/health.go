@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"rest-api/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pinger is satisfied by *sql.DB and *sqlx.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Probe answers the liveness and readiness checks of orchestrators.
+type Probe struct {
+	DB Pinger
+	// Timeout bounds the database ping, 2s by default.
+	Timeout time.Duration
+
+	draining atomic.Bool
+}
+
+// Drain makes readiness fail from now on, so that no new traffic is routed
+// to a server about to stop.
+func (p *Probe) Drain() {
+	p.draining.Store(true)
+}
+
+// Live reports that the process serves requests, for /healthz.
+func (p *Probe) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports whether the server should get traffic, for /readyz: it must
+// not be draining and the database must answer.
+func (p *Probe) Ready(c *gin.Context) {
+	if p.draining.Load() {
+		c.Error(apperr.Unavailable("the server is shutting down", nil))
+		return
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	if err := p.DB.PingContext(ctx); err != nil {
+		c.Error(apperr.Unavailable("the database is unreachable", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,66 @@
+// Package server runs the HTTP server until a signal asks it to stop, then
+// drains it, and answers the health checks meanwhile.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Server struct {
+	HTTP  *http.Server
+	Probe *Probe
+	// ShutdownTimeout bounds the wait for in-flight requests; zero waits
+	// for as long as they take.
+	ShutdownTimeout time.Duration
+	// DrainDelay keeps serving, with readiness failing, before shutting
+	// down, so that load balancers stop sending traffic first.
+	DrainDelay time.Duration
+}
+
+// Run listens on HTTP.Addr and serves until ctx is done, usually by
+// signal.NotifyContext.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is done, then stops accepting connections and
+// waits for in-flight requests. It returns nil after a clean shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	errc := make(chan error, 1)
+	go func() { errc <- s.HTTP.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	log.Print("server: shutting down")
+	if s.Probe != nil {
+		s.Probe.Drain()
+	}
+	time.Sleep(s.DrainDelay)
+
+	shutdownCtx := context.Background()
+	if s.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := s.HTTP.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server: shutdown: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Package telemetry exposes Prometheus metrics and OpenTelemetry traces of
+// the HTTP routes and repository calls.
+package telemetry
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	inFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served by method and route template.",
+	}, []string{"method", "route"})
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Repository call latency by table and operation.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"table", "op"})
+)
+
+// route is the template a request matched, e.g. /users/:id, so that ids do
+// not each get their own series.
+func route(c *gin.Context) string {
+	if r := c.FullPath(); r != "" {
+		return r
+	}
+	return "unmatched"
+}
+
+// Metrics counts and times the requests of every route.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method, route := c.Request.Method, route(c)
+		gauge := inFlight.WithLabelValues(method, route)
+		gauge.Inc()
+		start := time.Now()
+		defer func() {
+			gauge.Dec()
+			requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			requests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		}()
+		c.Next()
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format, for /metrics.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDB exports the connection pool stats of db, labelled with name.
+// Registering the same name twice is a no-op.
+func RegisterDB(db *sql.DB, name string) error {
+	err := prometheus.Register(collectors.NewDBStatsCollector(db, name))
+	if are := (prometheus.AlreadyRegisteredError{}); errors.As(err, &are) {
+		return nil
+	}
+	return err
+}
+
+// cacheCollector exports the counters of a repository.CachedRepository.
+type cacheCollector struct {
+	stats                            func() repository.CacheStats
+	hits, misses, evictions, entries *prometheus.Desc
+}
+
+// RegisterCache exports the hit, miss and eviction counters and the size of
+// a cache, labelled with name, e.g. RegisterCache("users", repo.Stats).
+// Registering the same name twice is a no-op.
+func RegisterCache(name string, stats func() repository.CacheStats) error {
+	labels := prometheus.Labels{"cache": name}
+	err := prometheus.Register(&cacheCollector{
+		stats:     stats,
+		hits:      prometheus.NewDesc("cache_hits_total", "Cache lookups served from the cache.", nil, labels),
+		misses:    prometheus.NewDesc("cache_misses_total", "Cache lookups that went to the database.", nil, labels),
+		evictions: prometheus.NewDesc("cache_evictions_total", "Entries dropped to make room for others.", nil, labels),
+		entries:   prometheus.NewDesc("cache_entries", "Entries held by the cache.", nil, labels),
+	})
+	if are := (prometheus.AlreadyRegisteredError{}); errors.As(err, &are) {
+		return nil
+	}
+	return err
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.entries
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Size))
+}
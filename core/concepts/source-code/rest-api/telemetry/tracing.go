@@ -0,0 +1,95 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "rest-api/telemetry"
+
+// propagator reads and writes W3C traceparent, tracestate and baggage.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Setup installs the W3C propagator and, when out is set, a tracer provider
+// writing the spans of service to out as JSON, for local runs. Without it
+// spans are not recorded but trace context still flows through. The
+// returned func flushes pending spans.
+func Setup(service string, out io.Writer) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagator)
+	if out == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out), stdouttrace.WithPrettyPrint())
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Tracing continues the trace of the traceparent header, or starts one, with
+// a server span around the request. Handlers reach it through
+// c.Request.Context().
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer().Start(ctx, c.Request.Method+" "+route(c),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route(c)),
+				attribute.String("url.path", c.Request.URL.Path),
+			))
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+type observer struct{}
+
+// Repository traces and times repository calls; install it as
+// repository.DefaultObserver.
+var Repository repository.Observer = observer{}
+
+func (observer) Observe(ctx context.Context, table, op string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracer().Start(ctx, table+"."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.collection.name", table),
+			attribute.String("db.operation.name", op),
+		))
+	return ctx, func() {
+		queryDuration.WithLabelValues(table, op).Observe(time.Since(start).Seconds())
+		span.End()
+	}
+}
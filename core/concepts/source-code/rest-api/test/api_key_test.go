@@ -0,0 +1,186 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest-api/auth"
+	"rest-api/handler"
+	"rest-api/middleware"
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type createdKey struct {
+	ID     int      `json:"id"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+}
+
+func setupAPIKeyRouter() *gin.Engine {
+	db := testDB()
+	store := auth.APIKeyStore{Repo: &repository.SQLRepository[model.APIKey]{DB: db, Table: "api_keys"}}
+	authn := auth.Authenticator{Keys: testKeys, APIKeys: &store}
+
+	r := gin.New()
+	r.Use(middleware.Errors())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/read", middleware.AuthMiddleware(authn), middleware.RequireScope(auth.ScopeUsersRead), ok)
+	r.POST("/write", middleware.AuthMiddleware(authn), middleware.RequireScope(auth.ScopeUsersWrite), ok)
+
+	admin := r.Group("/admin", middleware.AuthMiddleware(authn), middleware.RequireRole("admin"))
+	admin.POST("/api-keys", handler.CreateAPIKey(db))
+	admin.POST("/api-keys/:id/rotate", handler.RotateAPIKey(db))
+	admin.DELETE("/api-keys/:id", handler.RevokeAPIKey(db))
+	return r
+}
+
+func adminCall(t *testing.T, r http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token(t, "admin"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func withAPIKey(r http.Handler, method, path, key string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPIKey_Lifecycle(t *testing.T) {
+	r := setupAPIKeyRouter()
+
+	w := adminCall(t, r, "POST", "/admin/api-keys", gin.H{"name": "reporting", "scopes": []string{"users:read"}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var key createdKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+	assert.NotContains(t, w.Body.String(), auth.HashAPIKey(key.Key), "the hash is never exposed")
+
+	assert.Equal(t, http.StatusNoContent, withAPIKey(r, "GET", "/read", key.Key))
+	assert.Equal(t, http.StatusForbidden, withAPIKey(r, "POST", "/write", key.Key))
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(r, "GET", "/read", key.Key+"x"))
+
+	stored, err := (&repository.SQLRepository[model.APIKey]{DB: testDB(), Table: "api_keys"}).GetByID(context.Background(), key.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.LastUsedAt)
+	assert.Equal(t, auth.HashAPIKey(key.Key), stored.Hash)
+
+	w = adminCall(t, r, "POST", fmt.Sprintf("/admin/api-keys/%d/rotate", key.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var rotated createdKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, key.ID, rotated.ID)
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(r, "GET", "/read", key.Key))
+	assert.Equal(t, http.StatusNoContent, withAPIKey(r, "GET", "/read", rotated.Key))
+
+	w = adminCall(t, r, "DELETE", fmt.Sprintf("/admin/api-keys/%d", key.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(r, "GET", "/read", rotated.Key))
+}
+
+func TestAPIKey_Expired(t *testing.T) {
+	r := setupAPIKeyRouter()
+	past := time.Now().Add(-time.Hour)
+	w := adminCall(t, r, "POST", "/admin/api-keys", gin.H{"name": "old", "scopes": []string{"users:read"}, "expires_at": past})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var key createdKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(r, "GET", "/read", key.Key))
+}
+
+func TestAPIKey_AdminOnly(t *testing.T) {
+	r := setupAPIKeyRouter()
+	b, _ := json.Marshal(gin.H{"name": "x", "scopes": []string{"users:read"}})
+	req := httptest.NewRequest("POST", "/admin/api-keys", bytes.NewBuffer(b))
+	req.Header.Set("Authorization", "Bearer "+token(t, "user"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = adminCall(t, r, "POST", "/admin/api-keys", gin.H{"name": "x", "scopes": []string{"everything"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Unprocessable Entity",
+		"status": 422,
+		"detail": "the request has invalid fields",
+		"instance": "/admin/api-keys",
+		"errors": [{"field": "scopes[0]", "rule": "scope", "message": "scopes[0] must be a known scope"}]
+	}`, w.Body.String())
+}
+
+func TestAPIKey_RevokedStaysRevoked(t *testing.T) {
+	r := setupAPIKeyRouter()
+	w := adminCall(t, r, "POST", "/admin/api-keys", gin.H{"name": "gone", "scopes": []string{"users:read"}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var key createdKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+
+	w = adminCall(t, r, "DELETE", fmt.Sprintf("/admin/api-keys/%d", key.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var revoked model.APIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revoked))
+	require.NotNil(t, revoked.RevokedAt)
+
+	w = adminCall(t, r, "DELETE", fmt.Sprintf("/admin/api-keys/%d", key.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var again model.APIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+	assert.True(t, revoked.RevokedAt.Equal(*again.RevokedAt), "revoking twice keeps the first revocation")
+	assert.Equal(t, http.StatusNotFound, adminCall(t, r, "POST", fmt.Sprintf("/admin/api-keys/%d/rotate", key.ID), nil).Code)
+	assert.Equal(t, http.StatusNotFound, adminCall(t, r, "DELETE", "/admin/api-keys/999999", nil).Code)
+
+	// A request that read the key before the revocation cannot write it back.
+	repo := &repository.SQLRepository[model.APIKey]{DB: testDB(), Table: "api_keys"}
+	_, err := repo.UpdateFieldsWhere(context.Background(), key.ID, map[string]any{"last_used_at": time.Now()}, auth.LiveAPIKey)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	stored, err := repo.GetByID(context.Background(), key.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+	assert.Equal(t, http.StatusUnauthorized, withAPIKey(r, "GET", "/read", key.Key))
+}
+
+func TestAPIKey_LookupFailure(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	require.NoError(t, db.Close())
+	store := auth.APIKeyStore{Repo: &repository.SQLRepository[model.APIKey]{DB: db, Table: "api_keys"}}
+	authn := auth.Authenticator{Keys: testKeys, APIKeys: &store}
+
+	r := gin.New()
+	r.Use(middleware.Errors())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/read", middleware.AuthMiddleware(authn), ok)
+	r.GET("/public", middleware.OptionalAuth(authn), ok)
+
+	assert.Equal(t, http.StatusInternalServerError, withAPIKey(r, "GET", "/read", "rk_unknown"), "a lookup failure is no bad key")
+	assert.Equal(t, http.StatusInternalServerError, withAPIKey(r, "GET", "/public", "rk_unknown"))
+
+	req := httptest.NewRequest("GET", "/read", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/public", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code, "anonymous callers need no lookup")
+}
@@ -0,0 +1,172 @@
+package test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest-api/auth"
+	"rest-api/handler"
+	"rest-api/middleware"
+	"rest-api/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSecret = []byte("test-secret")
+	testKeys   = auth.KeySet{Issuer: "rest-api-test", Keys: map[string]any{"": testSecret}}
+)
+
+// token issues an HS256 token accepted by testKeys.
+func token(t *testing.T, roles ...string) string {
+	t.Helper()
+	tok, _, err := auth.Issuer{Issuer: testKeys.Issuer, Secret: testSecret, TTL: time.Minute}.Issue("tester", roles)
+	require.NoError(t, err)
+	return tok
+}
+
+// scopedToken issues a token of subject that lists its scopes, as needed
+// for the ExplicitScopes.
+func scopedToken(t *testing.T, subject string, scopes []string, roles ...string) string {
+	t.Helper()
+	now := time.Now()
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		Roles:  roles,
+		Scopes: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: testKeys.Issuer, Subject: subject,
+			IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}).SignedString(testSecret)
+	require.NoError(t, err)
+	return tok
+}
+
+func setupAuthRouter(keys auth.KeySet) *gin.Engine {
+	r := gin.New()
+	r.Use(middleware.Errors())
+	r.POST("/auth/token", handler.IssueToken(auth.Issuer{Issuer: keys.Issuer, Secret: testSecret, TTL: time.Minute}))
+	protected := r.Group("/", middleware.AuthMiddleware(auth.Authenticator{Keys: keys}))
+	protected.GET("/me", func(c *gin.Context) {
+		claims, _ := middleware.Claims(c)
+		c.JSON(http.StatusOK, gin.H{"sub": claims.Subject})
+	})
+	protected.DELETE("/admin", middleware.RequireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func call(r http.Handler, method, path, bearer string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.Claims) string {
+	t.Helper()
+	tok, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestAuthMiddleware_HS256(t *testing.T) {
+	r := setupAuthRouter(testKeys)
+
+	assert.Equal(t, http.StatusUnauthorized, call(r, "GET", "/me", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(r, "GET", "/me", "secret-token").Code)
+
+	w := call(r, "GET", "/me", token(t))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"sub":"tester"}`, w.Body.String())
+}
+
+func TestAuthMiddleware_RejectsInvalidClaims(t *testing.T) {
+	r := setupAuthRouter(testKeys)
+	valid := jwt.RegisteredClaims{Issuer: testKeys.Issuer, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	otherIssuer := valid
+	otherIssuer.Issuer = "someone-else"
+	noExpiry := valid
+	noExpiry.ExpiresAt = nil
+
+	for name, claims := range map[string]jwt.RegisteredClaims{
+		"expired": expired, "issuer": otherIssuer, "no expiry": noExpiry,
+	} {
+		tok := sign(t, jwt.SigningMethodHS256, testSecret, claims)
+		assert.Equal(t, http.StatusUnauthorized, call(r, "GET", "/me", tok).Code, name)
+	}
+	tok := sign(t, jwt.SigningMethodHS256, []byte("wrong-secret"), valid)
+	assert.Equal(t, http.StatusUnauthorized, call(r, "GET", "/me", tok).Code, "signature")
+}
+
+func TestAuthMiddleware_RS256(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys := auth.KeySet{Issuer: "rest-api-test", Keys: map[string]any{"rsa-1": &private.PublicKey}}
+	r := setupAuthRouter(keys)
+
+	claims := jwt.RegisteredClaims{Issuer: keys.Issuer, Subject: "svc", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+	rs := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	rs.Header["kid"] = "rsa-1"
+	tok, err := rs.SignedString(private)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, call(r, "GET", "/me", tok).Code)
+
+	// An HS256 token keyed with the public key bytes must not pass as RS256.
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	require.NoError(t, err)
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hs.Header["kid"] = "rsa-1"
+	forged, err := hs.SignedString(der)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, call(r, "GET", "/me", forged).Code)
+}
+
+func TestRequireRole(t *testing.T) {
+	r := setupAuthRouter(testKeys)
+
+	assert.Equal(t, http.StatusForbidden, call(r, "DELETE", "/admin", token(t, "user")).Code)
+	assert.Equal(t, http.StatusNoContent, call(r, "DELETE", "/admin", token(t, "admin")).Code)
+}
+
+func TestIssueToken(t *testing.T) {
+	r := setupAuthRouter(testKeys)
+	body, _ := json.Marshal(gin.H{"subject": "dev", "roles": []string{"admin"}})
+	req := httptest.NewRequest("POST", "/auth/token", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, http.StatusNoContent, call(r, "DELETE", "/admin", res.AccessToken).Code)
+}
+
+func TestIssueToken_OptIn(t *testing.T) {
+	body := map[string]any{"subject": "dev", "roles": []string{"admin"}}
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret})
+	assert.Equal(t, http.StatusNotFound, sendJSON(r, "POST", "/auth/token", body, nil).Code)
+
+	r = router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret, IssueTokens: true})
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/auth/token", body, nil).Code)
+}
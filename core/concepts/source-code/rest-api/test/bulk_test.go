@@ -0,0 +1,216 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"rest-api/bulk"
+	"rest-api/handler"
+	"rest-api/model"
+	"rest-api/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bulkRouter(t *testing.T) (*gin.Engine, func(contentType string) map[string]string) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys})
+	tok := token(t)
+	return r, func(contentType string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + tok, "Content-Type": contentType}
+	}
+}
+
+func importReport(t *testing.T, r http.Handler, body string, header map[string]string) handler.ImportReport {
+	t.Helper()
+	w := sendJSON(r, http.MethodPost, "/users:import", body, header)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report handler.ImportReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return report
+}
+
+func importedUsers(t *testing.T, emailPrefix string) int {
+	t.Helper()
+	var n int
+	require.NoError(t, testDB().Get(&n, "SELECT COUNT(*) FROM users WHERE email LIKE ?", emailPrefix+"%"))
+	return n
+}
+
+func TestImportUsers_CSV(t *testing.T) {
+	r, header := bulkRouter(t)
+	prefix := fmt.Sprintf("csv-%d-", time.Now().UnixNano())
+	taken := prefix + "taken@example.com"
+	testDB().MustExec("INSERT INTO users (name, email, created_at, updated_at) VALUES ('Taken', ?, ?, ?)", taken, time.Now(), time.Now())
+
+	body := strings.Join([]string{
+		"name,email",
+		"Ada," + prefix + "ada@example.com",
+		"x," + prefix + "short@example.com",
+		"Taken again," + taken,
+		`"Grace ""Amazing"" Hopper",` + prefix + "grace@example.com",
+		"Ada twice," + prefix + "ada@example.com",
+		"Too,many,cells",
+		"Linus,",
+	}, "\n")
+	report := importReport(t, r, body, header("text/csv; charset=utf-8"))
+	assert.Equal(t, 3, report.Imported)
+	assert.Equal(t, 4, report.Failed)
+	var lines []int
+	for _, e := range report.Errors {
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []int{3, 7, 4, 6}, lines, "malformed rows are reported as read, the others per batch")
+	assert.Equal(t, "min", report.Errors[0].Errors[0].Rule)
+	assert.Equal(t, "unique", report.Errors[2].Errors[0].Rule)
+	assert.Equal(t, "unique", report.Errors[3].Errors[0].Rule, "rows are unique among the file too")
+	assert.Equal(t, 3, importedUsers(t, prefix), "ada, grace and the taken user")
+
+	var grace model.User
+	require.NoError(t, testDB().Get(&grace, "SELECT * FROM users WHERE email = ?", prefix+"grace@example.com"))
+	assert.Equal(t, `Grace "Amazing" Hopper`, grace.Name)
+}
+
+func TestImportUsers_NDJSONInBatches(t *testing.T) {
+	r, header := bulkRouter(t)
+	prefix := fmt.Sprintf("ndjson-%d-", time.Now().UnixNano())
+	var body strings.Builder
+	rows := handler.ImportBatchSize + 10
+	for i := 1; i <= rows; i++ {
+		email := fmt.Sprintf("%s%d@example.com", prefix, i)
+		if i == 20 {
+			email = prefix + "10@example.com"
+		}
+		fmt.Fprintf(&body, `{"name":"User %d","email":%q}`+"\n", i, email)
+	}
+	body.WriteString("\n{not json}\n")
+
+	report := importReport(t, r, body.String(), header(bulk.NDJSON))
+	assert.Equal(t, rows-1, report.Imported, "the batch with a duplicate is redone without it")
+	require.Len(t, report.Errors, 2)
+	assert.Equal(t, 20, report.Errors[0].Line, "reported with the first batch")
+	assert.Equal(t, rows+2, report.Errors[1].Line)
+	assert.Contains(t, report.Errors[1].Detail, "malformed row")
+	assert.Equal(t, rows-1, importedUsers(t, prefix))
+}
+
+func TestImportUsers_Rejected(t *testing.T) {
+	r, header := bulkRouter(t)
+
+	problem(t, sendJSON(r, http.MethodPost, "/users:import", `[]`, header("application/json")), http.StatusUnsupportedMediaType)
+	p := problem(t, sendJSON(r, http.MethodPost, "/users:import", "name,password\nAda,secret", header(bulk.CSV)), http.StatusBadRequest)
+	assert.Contains(t, p.Detail, `unknown CSV column "password"`)
+	problem(t, sendJSON(r, http.MethodPost, "/users:import", "name\nAda", map[string]string{"Content-Type": bulk.CSV}), http.StatusUnauthorized)
+	problem(t, sendJSON(r, http.MethodPost, "/usersimport", "name\nAda", header(bulk.CSV)), http.StatusNotFound)
+}
+
+func TestExportUsers(t *testing.T) {
+	r, header := bulkRouter(t)
+	prefix := fmt.Sprintf("export-%d-", time.Now().UnixNano())
+	report := importReport(t, r, "name,email\nAda,"+prefix+"ada@example.com\nGrace,"+prefix+"grace@example.com", header(bulk.CSV))
+	require.Equal(t, 2, report.Imported)
+
+	w := sendJSON(r, http.MethodGet, "/users:export?format=ndjson", nil, header(""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, bulk.NDJSON, w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="users.ndjson"`, w.Header().Get("Content-Disposition"))
+	var exported []string
+	lines := bufio.NewScanner(w.Body)
+	for lines.Scan() {
+		var u model.User
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &u))
+		if strings.HasPrefix(u.Email, prefix) {
+			exported = append(exported, u.Name)
+		}
+	}
+	assert.Equal(t, []string{"Ada", "Grace"}, exported)
+
+	w = sendJSON(r, http.MethodGet, "/users:export", nil, header(""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, bulk.CSV, w.Header().Get("Content-Type"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	assert.Equal(t, []string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version"}, records[0])
+	exported = nil
+	for _, rec := range records[1:] {
+		if strings.HasPrefix(rec[2], prefix) {
+			exported = append(exported, rec[1])
+			assert.Empty(t, rec[5])
+			assert.Equal(t, "1", rec[6])
+		}
+	}
+	assert.Equal(t, []string{"Ada", "Grace"}, exported)
+
+	problem(t, sendJSON(r, http.MethodGet, "/users:export?format=xml", nil, header("")), http.StatusBadRequest)
+}
+
+func TestExportUsers_Pages(t *testing.T) {
+	r, header := bulkRouter(t)
+	prefix := fmt.Sprintf("export-pages-%d-", time.Now().UnixNano())
+	var body strings.Builder
+	body.WriteString("name,email\n")
+	for i := 0; i <= handler.ExportPageSize; i++ {
+		fmt.Fprintf(&body, "User %d,%s%d@example.com\n", i, prefix, i)
+	}
+	require.Equal(t, handler.ExportPageSize+1, importReport(t, r, body.String(), header(bulk.CSV)).Imported)
+
+	w := sendJSON(r, http.MethodGet, "/users:export?format=ndjson", nil, header(""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	seen, last, exported := map[int]bool{}, 0, 0
+	lines := bufio.NewScanner(w.Body)
+	for lines.Scan() {
+		var u model.User
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &u))
+		assert.Greater(t, u.ID, last)
+		assert.False(t, seen[u.ID])
+		seen[u.ID], last = true, u.ID
+		if strings.HasPrefix(u.Email, prefix) {
+			exported++
+		}
+	}
+	assert.Equal(t, handler.ExportPageSize+1, exported)
+}
+
+func TestImportUsers_IgnoresDatabaseColumns(t *testing.T) {
+	r, header := bulkRouter(t)
+	prefix := fmt.Sprintf("readonly-%d-", time.Now().UnixNano())
+	existing := model.User{Name: "Existing"}
+	require.NoError(t, handler.Users(testDB()).Create(context.Background(), &existing))
+
+	body := "id,name,email,created_at,updated_at,deleted_at,version\n" +
+		fmt.Sprintf("%d,Ada,%sada@example.com,2001-01-01T00:00:00Z,2001-01-01T00:00:00Z,2001-01-01T00:00:00Z,7", existing.ID, prefix)
+	report := importReport(t, r, body, header(bulk.CSV))
+	require.Equal(t, 1, report.Imported, report.Errors)
+	body = fmt.Sprintf(`{"id":%d,"name":"Grace","email":"%sgrace@example.com","deleted_at":"2001-01-01T00:00:00Z","version":7}`, existing.ID, prefix)
+	report = importReport(t, r, body, header(bulk.NDJSON))
+	require.Equal(t, 1, report.Imported, report.Errors)
+
+	var users []model.User
+	require.NoError(t, testDB().Select(&users, "SELECT * FROM users WHERE email LIKE ? ORDER BY id", prefix+"%"))
+	require.Len(t, users, 2)
+	for _, u := range users {
+		assert.NotEqual(t, existing.ID, u.ID)
+		assert.Equal(t, 1, u.Version)
+		assert.Nil(t, u.DeletedAt)
+		assert.True(t, u.CreatedAt.After(time.Now().Add(-time.Minute)))
+	}
+	var unchanged model.User
+	require.NoError(t, testDB().Get(&unchanged, "SELECT * FROM users WHERE id = ?", existing.ID))
+	assert.Equal(t, existing.Name, unchanged.Name)
+}
+
+func TestImportUsers_TooLarge(t *testing.T) {
+	r, header := bulkRouter(t)
+	body := "name\n\"" + strings.Repeat("a", handler.MaxImportBytes)
+	p := problem(t, sendJSON(r, http.MethodPost, "/users:import", body, header(bulk.CSV)), http.StatusRequestEntityTooLarge)
+	assert.Contains(t, p.Detail, "limited to")
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rest-api/model"
+	"rest-api/repository"
+	"rest-api/router"
+	"rest-api/telemetry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingObserver counts the repository calls by operation, slowing them
+// down by delay.
+type countingObserver struct {
+	mu    sync.Mutex
+	calls map[string]int
+	delay time.Duration
+}
+
+func (o *countingObserver) Observe(ctx context.Context, _, op string) (context.Context, func()) {
+	o.mu.Lock()
+	if o.calls == nil {
+		o.calls = map[string]int{}
+	}
+	o.calls[op]++
+	o.mu.Unlock()
+	time.Sleep(o.delay)
+	return ctx, func() {}
+}
+
+func (o *countingObserver) count(op string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.calls[op]
+}
+
+func cachedUsers(t *testing.T, size int, ttl time.Duration) (*repository.CachedRepository[model.User], *countingObserver) {
+	t.Helper()
+	obs := &countingObserver{}
+	repo := repository.NewCachedRepository(&repository.SQLRepository[model.User]{DB: testDB(), Table: "users", Observer: obs}, size, ttl)
+	return repo, obs
+}
+
+func createUsers(t *testing.T, repo repository.Repository[model.User], n int) []model.User {
+	t.Helper()
+	users := make([]model.User, n)
+	for i := range users {
+		users[i] = model.User{Name: fmt.Sprintf("cached-%d-%d", time.Now().UnixNano(), i)}
+		require.NoError(t, repo.Create(context.Background(), &users[i]))
+	}
+	return users
+}
+
+func TestCachedRepository_HitsAndMisses(t *testing.T) {
+	ctx := context.Background()
+	repo, obs := cachedUsers(t, 10, time.Minute)
+	user := createUsers(t, repo, 1)[0]
+
+	first, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	first.Name = "mutated by the caller"
+	second, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.Name, second.Name, "callers get copies")
+	assert.Equal(t, 1, obs.count("GetByID"))
+
+	_, err = repo.GetByID(ctx, -1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = repo.GetByID(ctx, -1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Equal(t, 3, obs.count("GetByID"), "errors are not cached")
+
+	assert.Equal(t, repository.CacheStats{Hits: 1, Misses: 3, Size: 1}, repo.Stats())
+}
+
+func TestCachedRepository_WritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	repo, obs := cachedUsers(t, 10, time.Minute)
+	user := createUsers(t, repo, 1)[0]
+
+	cached, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	cached.Name += "-updated"
+	require.NoError(t, repo.Update(ctx, user.ID, cached))
+	got, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, cached.Name, got.Name)
+	assert.Equal(t, cached.Version, got.Version)
+
+	_, err = repo.UpdateFields(ctx, user.ID, map[string]any{"name": "patched-" + user.Name, "version": got.Version})
+	require.NoError(t, err)
+	got, err = repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "patched-"+user.Name, got.Name)
+
+	require.NoError(t, repo.Delete(ctx, user.ID))
+	_, err = repo.GetByID(ctx, user.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Equal(t, 4, obs.count("GetByID"), "every read after a write misses")
+}
+
+func TestCachedRepository_TTLAndLRU(t *testing.T) {
+	ctx := context.Background()
+	repo, obs := cachedUsers(t, 2, 50*time.Millisecond)
+	users := createUsers(t, repo, 3)
+
+	for _, u := range users {
+		_, err := repo.GetByID(ctx, u.ID)
+		require.NoError(t, err)
+	}
+	stats := repo.Stats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	_, err := repo.GetByID(ctx, users[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, obs.count("GetByID"), "the least recently used entry was evicted")
+	_, err = repo.GetByID(ctx, users[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, obs.count("GetByID"))
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = repo.GetByID(ctx, users[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, obs.count("GetByID"), "expired entries are reloaded")
+}
+
+func TestCachedRepository_ConcurrentMissesLoadOnce(t *testing.T) {
+	repo, obs := cachedUsers(t, 10, time.Minute)
+	user := createUsers(t, repo, 1)[0]
+	obs.delay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := repo.GetByID(context.Background(), user.ID); err != nil || got.ID != user.ID {
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Zero(t, failed.Load())
+	assert.Equal(t, 1, obs.count("GetByID"))
+}
+
+func TestCachedRepository_Metrics(t *testing.T) {
+	repo, _ := cachedUsers(t, 10, time.Minute)
+	require.NoError(t, telemetry.RegisterCache("test_users", repo.Stats))
+	require.NoError(t, telemetry.RegisterCache("test_users", repo.Stats), "registering twice is a no-op")
+	user := createUsers(t, repo, 1)[0]
+	repo.GetByID(context.Background(), user.ID)
+	repo.GetByID(context.Background(), user.ID)
+
+	w := httptest.NewRecorder()
+	router.New(router.Deps{DB: testDB(), Keys: testKeys}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `cache_hits_total{cache="test_users"} 1`)
+	assert.Contains(t, body, `cache_misses_total{cache="test_users"} 1`)
+	assert.Contains(t, body, `cache_entries{cache="test_users"} 1`)
+}
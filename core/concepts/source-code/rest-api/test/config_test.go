@@ -0,0 +1,144 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rest-api/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// withSecret sets the JWT secret, the one setting without a default.
+func withSecret(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	withSecret(t)
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, "host=localhost port=5432 user=postgres password=postgres dbname=testdb sslmode=disable", cfg.DB.DataSourceName())
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+addr: ":9000"
+db:
+  host: file-host
+  name: file-db
+  max_open_conns: 10
+  conn_max_lifetime: 1m
+`)
+	withSecret(t)
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("ADDR", ":9001")
+
+	cfg, err := config.Load([]string{"-config", file, "-addr", ":9002"})
+	require.NoError(t, err)
+	assert.Equal(t, ":9002", cfg.Addr, "flags win over env")
+	assert.Equal(t, "env-host", cfg.DB.Host, "env wins over the file")
+	assert.Equal(t, "file-db", cfg.DB.Name, "the file wins over defaults")
+	assert.Equal(t, 10, cfg.DB.MaxOpenConns)
+	assert.Equal(t, config.Duration(time.Minute), cfg.DB.ConnMaxLifetime)
+	assert.Equal(t, 5, cfg.DB.MaxIdleConns)
+	assert.Equal(t, config.Duration(5*time.Second), cfg.DB.QueryTimeout)
+}
+
+func TestLoad_TOML(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+addr = ":7000"
+
+[db]
+driver = "sqlite3"
+dsn = "file::memory:"
+conn_max_idle_time = "30s"
+`)
+	t.Setenv("CONFIG_FILE", file)
+	withSecret(t)
+
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ":7000", cfg.Addr)
+	assert.Equal(t, "file::memory:", cfg.DB.DataSourceName())
+	assert.Equal(t, config.Duration(30*time.Second), cfg.DB.ConnMaxIdleTime)
+
+	db, err := config.InitDB(cfg.DB)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 25, db.Stats().MaxOpenConnections)
+}
+
+func TestLoad_SecretFiles(t *testing.T) {
+	t.Setenv("JWT_SECRET", "inline")
+	t.Setenv("JWT_SECRET_FILE", writeFile(t, "jwt", "from-file\n"))
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db", "it's secret"))
+
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.JWT.Secret)
+	assert.Contains(t, cfg.DB.DataSourceName(), `password='it\'s secret'`)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	t.Setenv("DB_DRIVER", "oracle")
+	t.Setenv("DB_MAX_IDLE_CONNS", "50")
+	t.Setenv("DB_MAX_OPEN_CONNS", "10")
+	t.Setenv("DB_QUERY_TIMEOUT", "0s")
+
+	_, err := config.Load(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `db.driver "oracle" is not registered`)
+	assert.Contains(t, err.Error(), "max_idle_conns")
+	assert.Contains(t, err.Error(), "query_timeout")
+
+	t.Setenv("DB_PORT", "abc")
+	_, err = config.Load(nil)
+	assert.ErrorContains(t, err, "DB_PORT")
+}
+
+func TestLoad_RequiresJWTKey(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	_, err := config.Load(nil)
+	assert.ErrorContains(t, err, "jwt.secret or jwt.public_key_file is required")
+	_, err = config.Load([]string{"migrate", "status"})
+	assert.NoError(t, err, "migrate needs no key")
+
+	t.Setenv("JWT_PUBLIC_KEY_FILE", "/keys/jwt.pem")
+	t.Setenv("JWT_ISSUE_TOKENS", "true")
+	_, err = config.Load(nil)
+	assert.ErrorContains(t, err, "jwt.issue_tokens requires jwt.secret")
+	assert.NotContains(t, err.Error(), "jwt.secret or jwt.public_key_file")
+}
+
+func TestInitDB_ReturnsError(t *testing.T) {
+	_, err := config.InitDB(config.DBConfig{Driver: "nope", DSN: "x"})
+	assert.Error(t, err)
+}
+
+func TestLoad_TrustedProxies(t *testing.T) {
+	withSecret(t)
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.TrustedProxies, "no proxy is trusted by default")
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.7")
+	cfg, err = config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.7"}, cfg.TrustedProxies)
+
+	t.Setenv("TRUSTED_PROXIES", "proxy.local")
+	_, err = config.Load(nil)
+	assert.ErrorContains(t, err, `"proxy.local" is no IP address or CIDR`)
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest-api/apperr"
+	"rest-api/crud"
+	"rest-api/middleware"
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupProductRouter(opts crud.Options[model.Product]) *gin.Engine {
+	r := gin.New()
+	r.Use(middleware.Errors())
+	opts.Name = "product"
+	opts.Filters = []string{"sku", "name"}
+	opts.Sorts = []string{"id", "name"}
+	crud.Register(r.Group("/products"), &repository.SQLRepository[model.Product]{DB: testDB(), Table: "products"}, opts)
+	return r
+}
+
+func sendJSON(r http.Handler, method, path string, body any, header map[string]string) *httptest.ResponseRecorder {
+	var b []byte
+	if s, ok := body.(string); ok {
+		b = []byte(s)
+	} else if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCRUD_Products(t *testing.T) {
+	r := setupProductRouter(crud.Options[model.Product]{})
+	sku := "SKU-" + t.Name()
+
+	w := sendJSON(r, "POST", "/products", gin.H{"sku": sku, "name": "Lamp", "price_cents": 1999, "stock": 3}, nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var p model.Product
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	path := fmt.Sprintf("/products/%d", p.ID)
+
+	w = sendJSON(r, "GET", path, nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = sendJSON(r, "GET", "/products?filter[sku]="+sku, nil, nil)
+	assert.Contains(t, w.Body.String(), `"name":"Lamp"`)
+
+	w = sendJSON(r, "PUT", path, gin.H{"sku": sku, "name": "Desk lamp", "price_cents": 2499}, nil)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	w = sendJSON(r, "PUT", path, gin.H{"sku": sku, "name": "Desk lamp", "price_cents": 2499}, map[string]string{"If-Match": `"1"`})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, 0, p.Stock, "PUT replaces every field")
+
+	w = sendJSON(r, "PATCH", path, gin.H{"stock": 7}, map[string]string{"If-Match": `"2"`})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "Desk lamp", p.Name, "PATCH keeps absent fields")
+	assert.Equal(t, 7, p.Stock)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = sendJSON(r, "PATCH", path, gin.H{"stock": 8}, map[string]string{"If-Match": `"2"`})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = sendJSON(r, "PATCH", path, gin.H{"stock": 8}, map[string]string{"If-Match": "*"})
+	require.Equal(t, http.StatusOK, w.Code, "* matches any version: %s", w.Body.String())
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	w = sendJSON(r, "PATCH", "/products/999999", gin.H{"stock": 8}, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendJSON(r, "POST", "/products", gin.H{"sku": sku, "name": "Copy"}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = sendJSON(r, "DELETE", path, nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(r, "GET", path, nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendJSON(r, "GET", "/products/abc", nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCRUD_HooksAndMiddleware(t *testing.T) {
+	var calls []string
+	r := setupProductRouter(crud.Options[model.Product]{
+		Middleware: crud.Middleware{
+			Delete: []gin.HandlerFunc{func(c *gin.Context) {
+				c.Error(apperr.Forbidden("no deletes"))
+				c.Abort()
+			}},
+		},
+		Hooks: crud.Hooks[model.Product]{
+			BeforeCreate: func(c *gin.Context, p *model.Product) error {
+				calls = append(calls, "before")
+				if p.PriceCents == 0 {
+					return apperr.BadRequest("free products are not sold", errors.New("zero price"))
+				}
+				p.Name += " (new)"
+				return nil
+			},
+			AfterCreate: func(c *gin.Context, p *model.Product) error {
+				calls = append(calls, fmt.Sprintf("after %d", p.ID))
+				return nil
+			},
+		},
+	})
+
+	w := sendJSON(r, "POST", "/products", gin.H{"sku": "FREE-" + t.Name(), "name": "Gift"}, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendJSON(r, "POST", "/products", gin.H{"sku": "PAID-" + t.Name(), "name": "Mug", "price_cents": 900}, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var p model.Product
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "Mug (new)", p.Name)
+	assert.Equal(t, []string{"before", "before", fmt.Sprintf("after %d", p.ID)}, calls)
+
+	w = sendJSON(r, "DELETE", fmt.Sprintf("/products/%d", p.ID), nil, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
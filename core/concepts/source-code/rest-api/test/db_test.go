@@ -0,0 +1,111 @@
+package test
+
+import (
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	deleted_at DATETIME,
+	version INTEGER NOT NULL DEFAULT 1
+);
+CREATE UNIQUE INDEX users_email_key ON users (email) WHERE email <> '' AND deleted_at IS NULL;
+CREATE TABLE products (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	sku TEXT NOT NULL,
+	name TEXT NOT NULL,
+	price_cents INTEGER NOT NULL DEFAULT 0,
+	stock INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	deleted_at DATETIME,
+	version INTEGER NOT NULL DEFAULT 1
+);
+CREATE UNIQUE INDEX products_sku_key ON products (sku) WHERE deleted_at IS NULL;
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	expires_at DATETIME,
+	last_used_at DATETIME,
+	revoked_at DATETIME,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	paused BOOLEAN NOT NULL DEFAULT false,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	owner TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_id INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME NOT NULL,
+	last_status INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	delivered_at DATETIME,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	UNIQUE (webhook_id, event_id)
+);
+CREATE TABLE outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	aggregate TEXT NOT NULL,
+	aggregate_id TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME NOT NULL,
+	dispatched_at DATETIME,
+	last_error TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE countries (
+	code TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	population INTEGER
+);
+CREATE TABLE memberships (
+	group_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	role TEXT NOT NULL DEFAULT 'member',
+	joined_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_id, user_id)
+);`
+
+var (
+	dbOnce   sync.Once
+	sharedDB *sqlx.DB
+)
+
+// testDB returns a shared in-memory SQLite database, so the suite needs no
+// database server.
+func testDB() *sqlx.DB {
+	dbOnce.Do(func() {
+		sharedDB = sqlx.MustConnect("sqlite3", "file:rest-api?mode=memory&cache=shared")
+		sharedDB.SetMaxOpenConns(1)
+		sharedDB.MustExec(schema)
+	})
+	return sharedDB
+}
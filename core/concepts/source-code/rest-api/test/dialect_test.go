@@ -0,0 +1,46 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectFor(t *testing.T) {
+	assert.Equal(t, repository.Postgres, repository.DialectFor("postgres"))
+	assert.Equal(t, repository.SQLite, repository.DialectFor("sqlite3"))
+	assert.Equal(t, repository.MySQL, repository.DialectFor("mysql"))
+}
+
+func TestDialect_Quote(t *testing.T) {
+	assert.Equal(t, `"public"."users"`, repository.Postgres.Quote("public.users"))
+	assert.Equal(t, `"we""ird"`, repository.SQLite.Quote(`we"ird`))
+	assert.Equal(t, "`users`", repository.MySQL.Quote("users"))
+}
+
+func TestDialect_Upsert(t *testing.T) {
+	assert.Equal(t, `ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+		repository.Postgres.Upsert([]string{"id"}, []string{"name"}))
+	assert.Equal(t, "ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)",
+		repository.MySQL.Upsert([]string{"id"}, []string{"name"}))
+}
+
+func TestUpsert(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+
+	user := model.User{Name: "upsert"}
+	require.NoError(t, repo.Create(ctx, &user))
+
+	user.Name = "upserted"
+	require.NoError(t, repo.Upsert(ctx, &user))
+
+	got, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "upserted", got.Name)
+}
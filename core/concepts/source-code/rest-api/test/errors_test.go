@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest-api/apperr"
+	"rest-api/handler"
+	"rest-api/middleware"
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func problem(t *testing.T, w *httptest.ResponseRecorder, status int) middleware.Problem {
+	t.Helper()
+	require.Equal(t, status, w.Code, w.Body.String())
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var p middleware.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, status, p.Status)
+	return p
+}
+
+func TestProblem_NotFound(t *testing.T) {
+	r, _ := setupRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/999999", nil))
+
+	p := problem(t, w, http.StatusNotFound)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, "users 999999 not found", p.Detail)
+	assert.Equal(t, "/users/999999", p.Instance)
+}
+
+func TestProblem_DatabaseDown(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.Close()
+
+	r := gin.New()
+	r.Use(middleware.Errors())
+	r.GET("/users/:id", handler.GetUserByID(db))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/1", nil))
+
+	p := problem(t, w, http.StatusInternalServerError)
+	assert.Equal(t, "an unexpected error occurred", p.Detail, "internals are not leaked")
+}
+
+func TestProblem_Unauthorized(t *testing.T) {
+	r := setupAuthRouter(testKeys)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+
+	problem(t, w, http.StatusUnauthorized)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestRepository_DomainErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+
+	_, err := repo.GetByID(ctx, 999999)
+	assert.Equal(t, apperr.KindNotFound, apperr.As(err).Kind)
+	assert.True(t, errors.Is(err, sql.ErrNoRows), "the driver error stays in the chain")
+
+	email := fmt.Sprintf("%s@example.com", t.Name())
+	require.NoError(t, repo.Create(ctx, &model.User{Name: "One", Email: email}))
+	err = repo.Create(ctx, &model.User{Name: "Two", Email: email})
+	assert.Equal(t, apperr.KindConflict, apperr.As(err).Kind)
+
+	user := model.User{Name: "Stale"}
+	require.NoError(t, repo.Create(ctx, &user))
+	user.Version = 0
+	err = repo.Update(ctx, user.ID, &user)
+	assert.Equal(t, apperr.KindConflict, apperr.As(err).Kind)
+	assert.ErrorIs(t, err, repository.ErrVersionConflict)
+
+	_, err = repo.List(ctx, repository.Query{Sorts: []repository.Sort{{Field: "secret"}}})
+	assert.Equal(t, apperr.KindBadRequest, apperr.As(err).Kind)
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pq: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestDialect_IsUniqueViolation(t *testing.T) {
+	assert.True(t, repository.Postgres.IsUniqueViolation(fmt.Errorf("insert: %w", sqlStateError("23505"))))
+	assert.False(t, repository.Postgres.IsUniqueViolation(sqlStateError("23503")))
+	assert.True(t, repository.MySQL.IsUniqueViolation(errors.New("Error 1062 (23000): Duplicate entry 'a' for key 'email'")))
+	assert.False(t, repository.SQLite.IsUniqueViolation(nil))
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"rest-api/migrate"
+	"rest-api/migrations"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_posts.up.sql":   {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT);")},
+	"0001_create_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+	"0002_add_body.up.sql":       {Data: []byte("ALTER TABLE posts ADD COLUMN body TEXT; CREATE INDEX posts_title ON posts (title);")},
+	"0002_add_body.down.sql":     {Data: []byte("DROP INDEX posts_title; ALTER TABLE posts DROP COLUMN body;")},
+	"README.md":                  {Data: []byte("ignored")},
+}
+
+func migrationDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	ctx := context.Background()
+	db := migrationDB(t)
+	m := &migrate.Migrator{DB: db, FS: testMigrations}
+
+	done, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, done, 2)
+	_, err = db.Exec("INSERT INTO posts (title, body) VALUES ('a', 'b')")
+	require.NoError(t, err)
+
+	done, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, done, "applied migrations are skipped")
+
+	done, err = m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, done, 1)
+	assert.Equal(t, int64(2), done[0].Version)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.Nil(t, status[1].AppliedAt)
+}
+
+func TestMigrator_FailedRunRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := migrationDB(t)
+	broken := fstest.MapFS{
+		"0001_create_posts.up.sql": testMigrations["0001_create_posts.up.sql"],
+		"0002_broken.up.sql":       {Data: []byte("ALTER TABLE nope ADD COLUMN x TEXT;")},
+	}
+	m := &migrate.Migrator{DB: db, FS: broken}
+
+	_, err := m.Up(ctx)
+	require.ErrorContains(t, err, "2_broken")
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, status[0].AppliedAt)
+}
+
+func TestMigrator_ConcurrentUp(t *testing.T) {
+	db := migrationDB(t)
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := &migrate.Migrator{DB: db, FS: testMigrations}
+			_, errs[i] = m.Up(context.Background())
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	var applied int
+	require.NoError(t, db.Get(&applied, "SELECT COUNT(*) FROM schema_migrations"))
+	assert.Equal(t, 2, applied)
+}
+
+func TestMigrate_Run(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	m := &migrate.Migrator{DB: migrationDB(t), FS: os.DirFS(dir)}
+	var out bytes.Buffer
+
+	require.NoError(t, migrate.Run(ctx, m, dir, []string{"create", "add_tags"}, &out))
+	require.NoError(t, migrate.Run(ctx, m, dir, []string{"create", "add_likes"}, &out))
+	assert.FileExists(t, filepath.Join(dir, "0001_add_tags.up.sql"))
+	assert.FileExists(t, filepath.Join(dir, "0002_add_likes.down.sql"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "0001_add_tags.up.sql"), []byte("CREATE TABLE tags (name TEXT);"), 0o644))
+
+	out.Reset()
+	require.NoError(t, migrate.Run(ctx, m, dir, []string{"up"}, &out))
+	assert.Contains(t, out.String(), "applied 1_add_tags")
+	assert.Contains(t, out.String(), "applied 2_add_likes")
+
+	out.Reset()
+	require.NoError(t, migrate.Run(ctx, m, dir, []string{"down"}, &out))
+	assert.Equal(t, "reverted 2_add_likes\n", out.String())
+
+	out.Reset()
+	require.NoError(t, migrate.Run(ctx, m, dir, []string{"status"}, &out))
+	assert.Regexp(t, `2\s+add_likes\s+pending`, out.String())
+
+	assert.Error(t, migrate.Run(ctx, m, dir, []string{"down", "zero"}, &out))
+	assert.Error(t, migrate.Run(ctx, m, dir, []string{"sideways"}, &out))
+}
+
+func TestMigrations_Embedded(t *testing.T) {
+	all, err := migrate.Load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	for i, m := range all {
+		assert.Equal(t, int64(i+1), m.Version, "versions have no gaps")
+		assert.NotEmpty(t, m.Down, "%d_%s has a down migration", m.Version, m.Name)
+	}
+}
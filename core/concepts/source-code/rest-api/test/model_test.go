@@ -0,0 +1,61 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type country struct {
+	Code string `db:"code,pk"`
+	Name string `db:"name"`
+}
+
+type membership struct {
+	GroupID  int    `db:"group_id,pk"`
+	UserID   int    `db:"user_id,pk"`
+	Role     string `db:"role,omitempty"`
+	JoinedAt string `db:"joined_at,readonly"`
+}
+
+func TestModel_CustomPrimaryKey(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[country]{DB: testDB(), Table: "countries"}
+
+	fr := country{Code: "FR", Name: "France"}
+	require.NoError(t, repo.Create(ctx, &fr))
+
+	fr.Name = "République française"
+	require.NoError(t, repo.Update(ctx, "FR", &fr))
+
+	got, err := repo.GetByID(ctx, "FR")
+	require.NoError(t, err)
+	assert.Equal(t, country{Code: "FR", Name: "République française"}, *got)
+}
+
+func TestModel_CompositeKey(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[membership]{DB: testDB(), Table: "memberships"}
+
+	m := membership{GroupID: 1, UserID: 2}
+	require.NoError(t, repo.Create(ctx, &m))
+	assert.Equal(t, "member", m.Role, "omitempty leaves the default to the database")
+	assert.NotEmpty(t, m.JoinedAt, "readonly columns are read back")
+
+	m.Role = "owner"
+	m.JoinedAt = "ignored"
+	require.NoError(t, repo.Update(ctx, repository.Key{1, 2}, &m))
+	assert.Equal(t, "owner", m.Role)
+	assert.NotEqual(t, "ignored", m.JoinedAt)
+
+	require.NoError(t, repo.Delete(ctx, repository.Key{1, 2}))
+	_, err := repo.GetByID(ctx, repository.Key{1, 2})
+	assert.Error(t, err)
+
+	_, err = repo.GetByID(ctx, 1)
+	assert.Error(t, err, "a composite key needs every column")
+}
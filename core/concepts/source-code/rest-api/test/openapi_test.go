@@ -0,0 +1,135 @@
+package test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"rest-api/openapi"
+	"rest-api/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const openapiGolden = "testdata/openapi.json"
+
+// TestOpenAPI_Golden fails when the routes or models change without the
+// committed document being regenerated with go test ./test -run OpenAPI -update.
+func TestOpenAPI_Golden(t *testing.T) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret, IssueTokens: true})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	if *update {
+		require.NoError(t, os.WriteFile(openapiGolden, w.Body.Bytes(), 0o644))
+	}
+	want, err := os.ReadFile(openapiGolden)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), w.Body.String(), "the API changed: rerun with -update and review the diff")
+}
+
+func TestOpenAPI_UndocumentedRoute(t *testing.T) {
+	r := gin.New()
+	r.GET("/documented", func(*gin.Context) {})
+	r.GET("/hidden", func(*gin.Context) {})
+	r.POST("/undocumented", func(*gin.Context) {})
+	spec := openapi.New("test", "1")
+	spec.Add("GET", "/documented", openapi.Op{})
+	spec.Add("DELETE", "/gone", openapi.Op{})
+	spec.Hide("GET", "/hidden")
+
+	_, err := spec.Generate(r.Routes())
+	assert.EqualError(t, err, "openapi: no route for DELETE /gone; undocumented route POST /undocumented")
+}
+
+func TestDocs(t *testing.T) {
+	r := gin.New()
+	r.GET("/docs/*any", openapi.Docs("/openapi.json"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "swagger-initializer.js")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs/swagger-initializer.js", nil))
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs/swagger-ui-bundle.js", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestOpenAPI_AuthMatchesMiddleware checks the documented auth of every
+// operation against the middleware actually in front of it: anonymous
+// callers must be turned away exactly when credentials are required, a
+// token holding the documented scopes and roles must get through, and one
+// missing any of them must not.
+func TestOpenAPI_AuthMatchesMiddleware(t *testing.T) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret, IssueTokens: true})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+
+	pathParam := regexp.MustCompile(`\{\w+\}`)
+	calls := 0
+	// call sends an empty body from its own address and subject, so that no
+	// rate limit is reached, and returns the status.
+	call := func(method, path string, scopes []string, roles ...string) int {
+		calls++
+		req := httptest.NewRequest(strings.ToUpper(method), pathParam.ReplaceAllString(path, "999999"), strings.NewReader("{}"))
+		req.RemoteAddr = fmt.Sprintf("198.51.%d.%d:1234", calls/250, calls%250+1)
+		req.Header.Set("Content-Type", "application/json")
+		if scopes != nil || roles != nil {
+			req.Header.Set("Authorization", "Bearer "+scopedToken(t, fmt.Sprintf("auth-%d", calls), scopes, roles...))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	denied := func(code int) bool { return code == http.StatusUnauthorized || code == http.StatusForbidden }
+
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			name := strings.ToUpper(method) + " " + path
+			required, optional := false, false
+			scopes := []string{}
+			for _, s := range op.Security {
+				if len(s) == 0 {
+					optional = true
+				} else if list, ok := s["bearer"]; ok {
+					required, scopes = true, list
+				}
+			}
+			required = required && !optional
+			if op.Security == nil {
+				assert.False(t, denied(call(method, path, nil)), "%s is documented as public", name)
+				continue
+			}
+			assert.Equal(t, required, call(method, path, nil) == http.StatusUnauthorized, "%s: documented as required=%v", name, required)
+			assert.False(t, denied(call(method, path, scopes, op.Roles...)), "%s: needs more than %v %v", name, scopes, op.Roles)
+			for i := range scopes {
+				// An unrelated scope keeps the claim, whose absence grants most scopes.
+				without := append(append([]string{"test:unrelated"}, scopes[:i]...), scopes[i+1:]...)
+				assert.Equal(t, http.StatusForbidden, call(method, path, without, op.Roles...), "%s: scope %s is not checked", name, scopes[i])
+			}
+			for i := range op.Roles {
+				without := append(append([]string{}, op.Roles[:i]...), op.Roles[i+1:]...)
+				assert.Equal(t, http.StatusForbidden, call(method, path, scopes, without...), "%s: role %s is not checked", name, op.Roles[i])
+			}
+		}
+	}
+}
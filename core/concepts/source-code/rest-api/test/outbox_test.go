@@ -0,0 +1,196 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rest-api/model"
+	"rest-api/outbox"
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOutbox creates an outbox table for the test alone, so that events of
+// other tests are not dispatched.
+func newOutbox(t *testing.T) repository.Outbox {
+	t.Helper()
+	box := repository.Outbox{Table: "outbox_" + strings.ToLower(t.Name())}
+	testDB().MustExec(strings.Replace(schema[strings.Index(schema, "CREATE TABLE outbox ("):strings.Index(schema, "CREATE TABLE countries")],
+		"outbox", box.Table, 1))
+	t.Cleanup(func() { testDB().MustExec("DROP TABLE " + box.Table) })
+	return box
+}
+
+func outboxEvents(t *testing.T, box repository.Outbox) []repository.Event {
+	t.Helper()
+	var events []repository.Event
+	require.NoError(t, testDB().Select(&events, "SELECT * FROM "+box.Table+" ORDER BY id"))
+	return events
+}
+
+func TestOutbox_RecordsWrites(t *testing.T) {
+	ctx := context.Background()
+	box := newOutbox(t)
+	repo := &repository.SQLRepository[model.User]{DB: testDB(), Table: "users", Outbox: &box}
+
+	user := model.User{Name: fmt.Sprintf("outbox-%d", time.Now().UnixNano())}
+	require.NoError(t, repo.Create(ctx, &user))
+	user.Name += "-renamed"
+	require.NoError(t, repo.Update(ctx, user.ID, &user))
+	require.NoError(t, repo.Delete(ctx, user.ID))
+	assert.ErrorIs(t, repo.Delete(ctx, user.ID), sql.ErrNoRows, "deleting again records nothing")
+	require.NoError(t, repo.Restore(ctx, user.ID))
+
+	events := outboxEvents(t, box)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+		assert.Equal(t, "users", e.Aggregate)
+		assert.Equal(t, fmt.Sprint(user.ID), e.AggregateID)
+		assert.Nil(t, e.DispatchedAt)
+	}
+	assert.Equal(t, []string{"users.created", "users.updated", "users.deleted", "users.restored"}, types)
+
+	var payload model.User
+	require.NoError(t, json.Unmarshal(events[1].Payload, &payload))
+	assert.Equal(t, user.Name, payload.Name)
+	assert.Equal(t, 2, payload.Version)
+	assert.JSONEq(t, fmt.Sprintf(`{"id":%d}`, user.ID), string(events[2].Payload))
+}
+
+func TestOutbox_RolledBackWithTheWrite(t *testing.T) {
+	ctx := context.Background()
+	box := newOutbox(t)
+	repo := &repository.SQLRepository[model.User]{DB: testDB(), Table: "users", Outbox: &box}
+	email := fmt.Sprintf("outbox-%d@example.com", time.Now().UnixNano())
+	require.NoError(t, repo.Create(ctx, &model.User{Name: "first", Email: email}))
+
+	err := repo.Create(ctx, &model.User{Name: "second", Email: email})
+	require.Error(t, err, "the email is taken")
+
+	boom := errors.New("boom")
+	err = repository.UnitOfWork{DB: testDB()}.WithTx(ctx, func(tx *repository.Tx) error {
+		require.NoError(t, repo.InTx(tx).Create(ctx, &model.User{Name: "third"}))
+		return boom
+	})
+	require.ErrorIs(t, err, boom)
+
+	assert.Len(t, outboxEvents(t, box), 1, "failed writes record nothing")
+}
+
+func TestDispatcher_DeliversAndRetries(t *testing.T) {
+	ctx := context.Background()
+	box := newOutbox(t)
+	repo := &repository.SQLRepository[model.User]{DB: testDB(), Table: "users", Outbox: &box}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repo.Create(ctx, &model.User{Name: fmt.Sprintf("dispatched-%d", i)}))
+	}
+
+	ch := make(chan repository.Event, 10)
+	failures := 1
+	flaky := outbox.SinkFunc(func(_ context.Context, e repository.Event) error {
+		if e.ID == outboxEvents(t, box)[1].ID && failures > 0 {
+			failures--
+			return errors.New("receiver down")
+		}
+		return nil
+	})
+	d := &outbox.Dispatcher{
+		DB: testDB(), Outbox: box, Sinks: []outbox.Sink{outbox.Channel(ch), flaky},
+		Backoff: func(int) time.Duration { return 0 },
+	}
+
+	n, err := d.DispatchOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	events := outboxEvents(t, box)
+	assert.NotNil(t, events[0].DispatchedAt)
+	assert.Nil(t, events[1].DispatchedAt)
+	assert.Equal(t, 1, events[1].Attempts)
+	assert.Equal(t, "receiver down", events[1].LastError)
+
+	n, err = d.DispatchOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "the failed event is retried")
+	n, err = d.DispatchOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "dispatched events are not sent again")
+
+	close(ch)
+	var ids []int64
+	for e := range ch {
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []int64{events[0].ID, events[1].ID, events[2].ID, events[1].ID}, ids,
+		"every sink gets the retried event again")
+}
+
+func TestDispatcher_GivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	box := newOutbox(t)
+	repo := &repository.SQLRepository[model.User]{DB: testDB(), Table: "users", Outbox: &box}
+	require.NoError(t, repo.Create(ctx, &model.User{Name: "undeliverable"}))
+
+	down := outbox.SinkFunc(func(context.Context, repository.Event) error { return errors.New("down") })
+	d := &outbox.Dispatcher{DB: testDB(), Outbox: box, Sinks: []outbox.Sink{down}, MaxAttempts: 2,
+		Backoff: func(int) time.Duration { return 0 }}
+	for i := 0; i < 3; i++ {
+		_, err := d.DispatchOnce(ctx)
+		require.NoError(t, err)
+	}
+	events := outboxEvents(t, box)
+	assert.Equal(t, 2, events[0].Attempts)
+	assert.Nil(t, events[0].DispatchedAt)
+}
+
+func TestDispatcher_BacksOff(t *testing.T) {
+	ctx := context.Background()
+	box := newOutbox(t)
+	repo := &repository.SQLRepository[model.User]{DB: testDB(), Table: "users", Outbox: &box}
+	require.NoError(t, repo.Create(ctx, &model.User{Name: "backed-off"}))
+
+	down := outbox.SinkFunc(func(context.Context, repository.Event) error { return errors.New("down") })
+	d := &outbox.Dispatcher{DB: testDB(), Outbox: box, Sinks: []outbox.Sink{down}}
+	_, err := d.DispatchOnce(ctx)
+	require.NoError(t, err)
+	_, err = d.DispatchOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, outboxEvents(t, box)[0].Attempts, "the event waits for its next attempt")
+
+	backoff := outbox.Exponential(time.Second, 5*time.Second)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		[]time.Duration{backoff(1), backoff(2), backoff(3), backoff(4)})
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink := outbox.WebhookSink{URL: srv.URL}
+	e := repository.Event{ID: 7, Type: "users.created", Aggregate: "users", AggregateID: "1", Payload: repository.RawJSON(`{"id":1}`)}
+	require.NoError(t, sink.Send(context.Background(), e))
+	assert.Equal(t, "7", got.Header.Get("X-Event-ID"))
+	assert.Equal(t, "users.created", got.Header.Get("X-Event-Type"))
+	assert.JSONEq(t, `{"id":7,"type":"users.created","aggregate":"users","aggregate_id":"1","payload":{"id":1},"created_at":"0001-01-01T00:00:00Z"}`, string(body))
+
+	status = http.StatusBadGateway
+	assert.ErrorContains(t, sink.Send(context.Background(), e), "502")
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"rest-api/apperr"
+	"rest-api/crud"
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchHeaders(contentType, etag string) map[string]string {
+	return map[string]string{"Content-Type": contentType, "If-Match": etag}
+}
+
+func TestPatchUser_MergePatch(t *testing.T) {
+	_, r := setupRouter()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	user := model.User{Name: "Merge", Email: "merge@example.com"}
+	require.NoError(t, repo.Create(context.Background(), &user))
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	w := sendJSON(r, "PATCH", path, `{"name":"Merged"}`, map[string]string{"Content-Type": crud.MergePatchType})
+	problem(t, w, http.StatusPreconditionRequired)
+
+	w = sendJSON(r, "PATCH", path, `{"name":"Merged"}`, patchHeaders(crud.MergePatchType, `"1"`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var got model.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "Merged", got.Name)
+	assert.Equal(t, "merge@example.com", got.Email, "absent fields are kept")
+
+	w = sendJSON(r, "PATCH", path, `{"email":null}`, patchHeaders(crud.MergePatchType, `"2"`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "", got.Email, "null removes the field")
+
+	w = sendJSON(r, "PATCH", path, `{"name":null}`, patchHeaders(crud.MergePatchType, `"3"`))
+	p := problem(t, w, http.StatusUnprocessableEntity)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "name", p.Errors[0].Field)
+
+	w = sendJSON(r, "PATCH", path, `{"name":"Stale"}`, patchHeaders(crud.MergePatchType, `"1"`))
+	problem(t, w, http.StatusPreconditionFailed)
+}
+
+func TestPatchUser_JSONPatch(t *testing.T) {
+	_, r := setupRouter()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	user := model.User{Name: "Ops"}
+	require.NoError(t, repo.Create(context.Background(), &user))
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	ops := `[{"op":"test","path":"/name","value":"Ops"},{"op":"replace","path":"/name","value":"Patched"},{"op":"add","path":"/email","value":"ops@example.com"}]`
+	w := sendJSON(r, "PATCH", path, ops, patchHeaders(crud.JSONPatchType, `"1"`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got model.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "Patched", got.Name)
+	assert.Equal(t, "ops@example.com", got.Email)
+	assert.Equal(t, user.CreatedAt.Unix(), got.CreatedAt.Unix())
+
+	w = sendJSON(r, "PATCH", path, `[{"op":"test","path":"/name","value":"Ops"}]`, patchHeaders(crud.JSONPatchType, `"2"`))
+	problem(t, w, http.StatusConflict)
+
+	w = sendJSON(r, "PATCH", path, `[{"op":"remove","path":"/nickname"}]`, patchHeaders(crud.JSONPatchType, `"2"`))
+	problem(t, w, http.StatusBadRequest)
+
+	w = sendJSON(r, "PATCH", path, `name=x`, patchHeaders("application/x-www-form-urlencoded", `"2"`))
+	problem(t, w, http.StatusUnsupportedMediaType)
+}
+
+func TestUpdateFields(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	user := model.User{Name: "Fields", Email: "fields@example.com"}
+	require.NoError(t, repo.Create(ctx, &user))
+
+	// Written behind the repository's back: UpdateFields must not undo it.
+	_, err := testDB().Exec("UPDATE users SET email = 'other@example.com' WHERE id = ?", user.ID)
+	require.NoError(t, err)
+
+	updated, err := repo.UpdateFields(ctx, user.ID, map[string]any{"name": "Renamed", "version": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", updated.Name)
+	assert.Equal(t, "other@example.com", updated.Email)
+	assert.Equal(t, 2, updated.Version)
+
+	_, err = repo.UpdateFields(ctx, user.ID, map[string]any{"name": "Again", "version": 1})
+	assert.ErrorIs(t, err, repository.ErrVersionConflict)
+
+	_, err = repo.UpdateFields(ctx, user.ID, map[string]any{"created_at": user.CreatedAt, "version": 2})
+	assert.Equal(t, apperr.KindBadRequest, apperr.As(err).Kind)
+}
+
+func TestChanges(t *testing.T) {
+	before := model.User{ID: 1, Name: "A", Email: "a@example.com", Version: 3}
+	after := before
+	after.ID, after.Version, after.Name = 2, 4, "B"
+	assert.Equal(t, map[string]any{"name": "B"}, repository.Changes(&before, &after))
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type usersPage struct {
+	Data       []User `json:"data"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func TestGetUsers_CursorPagination(t *testing.T) {
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	ctx := context.Background()
+	prefix := fmt.Sprintf("cursor-%d-", time.Now().UnixNano())
+	for i := 0; i < 5; i++ {
+		require.NoError(t, repo.Create(ctx, &model.User{Name: fmt.Sprintf("%s%d", prefix, i)}))
+	}
+
+	r, _ := setupRouter()
+	var names []string
+	cursor := ""
+	for {
+		q := url.Values{"filter[name][like]": {prefix}, "sort": {"-name"}, "size": {"2"}}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		req := httptest.NewRequest("GET", "/users?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var page usersPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		for _, u := range page.Data {
+			names = append(names, u.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	assert.Equal(t, []string{prefix + "4", prefix + "3", prefix + "2", prefix + "1", prefix + "0"}, names)
+}
+
+func TestGetUsers_InvalidQuery(t *testing.T) {
+	r, _ := setupRouter()
+	for _, q := range []string{
+		"filter[password]=x", "sort=password", "cursor=not-a-cursor",
+		"page=2", "offset=10", "size=ten", "size=0", "filter[name]=a&filter[name]=b", "size=1&size=2",
+		"filter[id]=abc", "filter[id][gt]=1.5", "filter[id][in]=1,x", "filter[id][like]=1",
+	} {
+		req := httptest.NewRequest("GET", "/users?"+q, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+	}
+}
+
+func TestGetUsers_LikeEscapesWildcards(t *testing.T) {
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	ctx := context.Background()
+	prefix := fmt.Sprintf("like-%d-", time.Now().UnixNano())
+	for _, name := range []string{"100% sure", "100 percent", "a_b", "axb", "wow!"} {
+		require.NoError(t, repo.Create(ctx, &model.User{Name: prefix + name}))
+	}
+
+	r, _ := setupRouter()
+	for _, name := range []string{"100% sure", "a_b", "wow!"} {
+		q := url.Values{"filter[name][like]": {prefix + strings.Fields(name)[0]}}
+		req := httptest.NewRequest("GET", "/users?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var page usersPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		var names []string
+		for _, u := range page.Data {
+			names = append(names, u.Name)
+		}
+		assert.Equal(t, []string{prefix + name}, names, "wildcards match themselves")
+	}
+}
+
+func TestGetUsers_CursorOfAnotherSort(t *testing.T) {
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	ctx := context.Background()
+	prefix := fmt.Sprintf("resort-%d-", time.Now().UnixNano())
+	for i := 0; i < 2; i++ {
+		require.NoError(t, repo.Create(ctx, &model.User{Name: fmt.Sprintf("%s%d", prefix, i)}))
+	}
+
+	r, _ := setupRouter()
+	get := func(q url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/users?"+q.Encode(), nil))
+		return w
+	}
+	w := get(url.Values{"filter[name][like]": {prefix}, "sort": {"-name"}, "size": {"1"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page usersPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.NotEmpty(t, page.NextCursor)
+
+	w = get(url.Values{"filter[name][like]": {prefix}, "sort": {"name"}, "size": {"1"}, "cursor": {page.NextCursor}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "the cursor belongs to another sort")
+	w = get(url.Values{"filter[name][like]": {prefix}, "sort": {"-name"}, "size": {"1"}, "cursor": {page.NextCursor}})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestList_TypedFilters(t *testing.T) {
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	ctx := context.Background()
+	user := model.User{Name: fmt.Sprintf("typed-%d", time.Now().UnixNano())}
+	require.NoError(t, repo.Create(ctx, &user))
+
+	list := func(filters ...repository.Filter) []model.User {
+		page, err := repo.List(ctx, repository.Query{
+			Filters:        append(filters, repository.Filter{Field: "name", Op: repository.OpEq, Value: user.Name}),
+			AllowedFilters: []string{"id", "name", "created_at"},
+		})
+		require.NoError(t, err)
+		return page.Data
+	}
+	id := strconv.Itoa(user.ID)
+	assert.Len(t, list(repository.Filter{Field: "id", Op: repository.OpIn, Value: []string{"0", id}}), 1)
+	assert.Len(t, list(repository.Filter{Field: "id", Op: repository.OpGte, Value: id}), 1)
+	before := user.CreatedAt.Add(-time.Second).Format(time.RFC3339)
+	after := user.CreatedAt.Add(time.Hour).Format(time.RFC3339)
+	assert.Len(t, list(repository.Filter{Field: "created_at", Op: repository.OpGte, Value: before}), 1, "times compare as times")
+	assert.Empty(t, list(repository.Filter{Field: "created_at", Op: repository.OpGte, Value: after}))
+
+	_, err := repo.List(ctx, repository.Query{
+		Filters:        []repository.Filter{{Field: "created_at", Op: repository.OpEq, Value: "yesterday"}},
+		AllowedFilters: []string{"created_at"},
+	})
+	assert.ErrorIs(t, err, repository.ErrInvalidQuery)
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"rest-api/auth"
+	"rest-api/middleware"
+	"rest-api/ratelimit"
+	"rest-api/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock the tests move by hand.
+type fakeClock struct{ now time.Time }
+
+func (f *fakeClock) Now() time.Time          { return f.now }
+func (f *fakeClock) Advance(d time.Duration) { f.now = f.now.Add(d) }
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	store := &ratelimit.MemoryStore{Now: clock.Now}
+	p := ratelimit.Policy{Name: "p", Rate: 2, Period: time.Second, Burst: 3}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, err := store.Take(ctx, "k", p)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+		assert.Equal(t, 3, res.Limit)
+	}
+	res, _ := store.Take(ctx, "k", p)
+	assert.False(t, res.Allowed, "the burst is spent")
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	other, _ := store.Take(ctx, "other", p)
+	assert.True(t, other.Allowed, "buckets are per key")
+
+	clock.Advance(500 * time.Millisecond)
+	res, _ = store.Take(ctx, "k", p)
+	assert.True(t, res.Allowed, "a token is refilled every 1/rate")
+	res, _ = store.Take(ctx, "k", p)
+	assert.False(t, res.Allowed)
+
+	clock.Advance(time.Hour)
+	res, _ = store.Take(ctx, "k", p)
+	assert.Equal(t, 2, res.Remaining, "refills stop at the burst")
+}
+
+func TestMemoryStore_EvictsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	store := &ratelimit.MemoryStore{Now: clock.Now, IdleTimeout: time.Minute}
+	p := ratelimit.Policy{Name: "p", Rate: 1, Period: time.Second}
+	ctx := context.Background()
+
+	store.Take(ctx, "idle", p)
+	clock.Advance(30 * time.Second)
+	store.Take(ctx, "busy", p)
+	require.Equal(t, 2, store.Len())
+
+	clock.Advance(45 * time.Second)
+	store.Take(ctx, "busy", p)
+	assert.Equal(t, 1, store.Len(), "only the bucket idle for a minute is evicted")
+}
+
+func TestRateLimit_TooManyRequests(t *testing.T) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret, IssueTokens: true})
+	body := map[string]any{"subject": "alice"}
+
+	for i := 0; i < router.TokenLimit.Burst; i++ {
+		w := sendJSON(r, "POST", "/auth/token", body, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	w := sendJSON(r, "POST", "/auth/token", body, nil)
+	p := problem(t, w, http.StatusTooManyRequests)
+	assert.Contains(t, p.Detail, "retry in 6s")
+	assert.Equal(t, "6", w.Header().Get("Retry-After"))
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "10;w=60", w.Header().Get("RateLimit-Policy"))
+}
+
+func TestRateLimit_KeyedBySubject(t *testing.T) {
+	limits := ratelimit.Limiter{Store: &ratelimit.MemoryStore{}}
+	r := gin.New()
+	r.Use(middleware.Errors(), middleware.OptionalAuth(auth.Authenticator{Keys: testKeys}))
+	r.GET("/", limits.Limit(ratelimit.Policy{Name: "one", Rate: 1, Period: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	alice := map[string]string{"Authorization": "Bearer " + token(t)}
+	assert.Equal(t, http.StatusNoContent, sendJSON(r, "GET", "/", nil, alice).Code)
+	assert.Equal(t, http.StatusTooManyRequests, sendJSON(r, "GET", "/", nil, alice).Code)
+	assert.Equal(t, http.StatusNoContent, sendJSON(r, "GET", "/", nil, nil).Code,
+		"anonymous callers from the same IP have their own bucket")
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Take(context.Context, string, ratelimit.Policy) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
+
+func TestRateLimit_StoreFailureLetsRequestsThrough(t *testing.T) {
+	limits := ratelimit.Limiter{Store: brokenStore{}}
+	r := gin.New()
+	r.GET("/", limits.Limit(ratelimit.Policy{Name: "one", Rate: 1, Period: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusNoContent, sendJSON(r, "GET", "/", nil, nil).Code)
+	}
+}
+
+func TestRateLimit_IgnoresUntrustedForwardedFor(t *testing.T) {
+	body := map[string]any{"subject": "alice"}
+	spoof := func(i int) map[string]string {
+		return map[string]string{"X-Forwarded-For": fmt.Sprintf("203.0.113.%d", i)}
+	}
+
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret, IssueTokens: true})
+	for i := 0; i < router.TokenLimit.Burst; i++ {
+		require.Equal(t, http.StatusOK, sendJSON(r, "POST", "/auth/token", body, spoof(i)).Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, sendJSON(r, "POST", "/auth/token", body, spoof(99)).Code,
+		"a spoofed X-Forwarded-For gets no fresh bucket")
+
+	// httptest requests come from 192.0.2.1.
+	r = router.New(router.Deps{DB: testDB(), Keys: testKeys, Secret: testSecret, IssueTokens: true, TrustedProxies: []string{"192.0.2.0/24"}})
+	for i := 0; i < router.TokenLimit.Burst; i++ {
+		require.Equal(t, http.StatusOK, sendJSON(r, "POST", "/auth/token", body, spoof(1)).Code)
+	}
+	assert.Equal(t, http.StatusOK, sendJSON(r, "POST", "/auth/token", body, spoof(2)).Code,
+		"behind a trusted proxy each forwarded client has its own bucket")
+}
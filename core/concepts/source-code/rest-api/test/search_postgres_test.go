@@ -0,0 +1,101 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"rest-api/handler"
+	"rest-api/migrate"
+	"rest-api/migrations"
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresDB migrates a schema of its own in the database of
+// POSTGRES_TEST_DSN, e.g. the docker-compose one with
+// "host=localhost user=postgres password=postgres dbname=testdb sslmode=disable",
+// and drops it at the end. The test is skipped without it.
+func postgresDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	require.NoError(t, err)
+	// One connection, so that every query sees the search_path.
+	db.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("search_test_%d", time.Now().UnixNano())
+	db.MustExec("CREATE SCHEMA " + schema)
+	t.Cleanup(func() {
+		db.MustExec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+	db.MustExec("SET search_path TO " + schema + ", public")
+	_, err = (&migrate.Migrator{DB: db, FS: migrations.FS}).Up(context.Background())
+	require.NoError(t, err)
+	return db
+}
+
+func TestPostgresSearch(t *testing.T) {
+	db := postgresDB(t)
+	ctx := context.Background()
+	repo := &repository.SQLRepository[model.User]{DB: db, Table: "users"}
+	var ids []int
+	for _, u := range []model.User{
+		{Name: "Ada Lovelace", Email: "ada@example.com"},
+		{Name: "Lovelace Society", Email: "society@example.com"},
+		{Name: "Grace Hopper", Email: "grace@example.com"},
+		{Name: "<b>Lovelace</b> Fan", Email: "fan@example.com"},
+		{Name: "Deleted Lovelace", Email: "deleted@example.com"},
+	} {
+		require.NoError(t, repo.Create(ctx, &u))
+		ids = append(ids, u.ID)
+	}
+	require.NoError(t, repo.Delete(ctx, ids[4]))
+	search := handler.UserSearch(db)
+
+	page, err := search.Search(ctx, repository.SearchQuery{Text: "ada lovelace", Limit: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Data)
+	assert.Equal(t, ids[0], page.Data[0].Entity.ID, "the row with both words ranks first")
+	assert.Equal(t, "<mark>Ada</mark> <mark>Lovelace</mark>", page.Data[0].Highlights["name"])
+	for i := 1; i < len(page.Data); i++ {
+		assert.GreaterOrEqual(t, page.Data[i-1].Rank, page.Data[i].Rank)
+	}
+
+	var seen []int
+	q := repository.SearchQuery{Text: "lovelace", Limit: 2}
+	for {
+		page, err := search.Search(ctx, q)
+		require.NoError(t, err)
+		for _, h := range page.Data {
+			seen = append(seen, h.Entity.ID)
+			if h.Entity.ID == ids[3] {
+				assert.Equal(t, "&lt;b&gt;<mark>Lovelace</mark>&lt;/b&gt; Fan", h.Highlights["name"])
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	assert.ElementsMatch(t, []int{ids[0], ids[1], ids[3]}, seen, "deleted users are not found")
+
+	page, err = search.Search(ctx, repository.SearchQuery{Text: "Lovelac", Limit: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Data, "misspelt words match by trigram similarity")
+	assert.Equal(t, ids[0], page.Data[0].Entity.ID)
+
+	page, err = search.Search(ctx, repository.SearchQuery{Text: "nobody"})
+	require.NoError(t, err)
+	assert.Empty(t, page.Data)
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"rest-api/apperr"
+	"rest-api/model"
+	"rest-api/repository"
+	"rest-api/router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceSearch searches users in memory, ranking names that start with the
+// text first, the way a database Searcher pages its hits.
+type sliceSearch struct {
+	users []model.User
+	last  repository.SearchQuery
+}
+
+func (s *sliceSearch) Search(_ context.Context, q repository.SearchQuery) (repository.SearchPage[model.User], error) {
+	s.last = q
+	limit, offset, err := q.Bounds()
+	if err != nil {
+		return repository.SearchPage[model.User]{}, apperr.BadRequest(err.Error(), err)
+	}
+	var hits []repository.Hit[model.User]
+	text := strings.ToLower(q.Text)
+	for _, u := range s.users {
+		name := strings.ToLower(u.Name)
+		i := strings.Index(name, text)
+		if i < 0 {
+			continue
+		}
+		marked, _ := repository.Highlight(u.Name[:i] + repository.MatchStart + u.Name[i:i+len(text)] + repository.MatchStop + u.Name[i+len(text):])
+		hit := repository.Hit[model.User]{Entity: u, Rank: 1 / float64(i+1), Highlights: map[string]string{"name": marked}}
+		hits = append(hits, hit)
+	}
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+	return repository.NewSearchPage(hits[offset:min(len(hits), offset+limit+1)], limit, offset), nil
+}
+
+func TestSearchQuery_Pages(t *testing.T) {
+	hits := make([]repository.Hit[int], 6)
+	for i := range hits {
+		hits[i].Entity = i
+	}
+	q := repository.SearchQuery{Limit: 2}
+	var seen []int
+	for {
+		limit, offset, err := q.Bounds()
+		require.NoError(t, err)
+		page := repository.NewSearchPage(hits[offset:min(len(hits), offset+limit+1)], limit, offset)
+		for _, h := range page.Data {
+			seen = append(seen, h.Entity)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, seen)
+
+	limit, _, err := repository.SearchQuery{Limit: 1000}.Bounds()
+	require.NoError(t, err)
+	assert.Equal(t, repository.MaxLimit, limit)
+	_, _, err = repository.SearchQuery{Cursor: "not a cursor"}.Bounds()
+	assert.ErrorIs(t, err, repository.ErrInvalidQuery)
+	assert.Equal(t, []repository.Hit[int]{}, repository.NewSearchPage[int](nil, 10, 0).Data)
+}
+
+func TestSearchUsers(t *testing.T) {
+	search := &sliceSearch{users: []model.User{
+		{ID: 1, Name: "Ada Lovelace"}, {ID: 2, Name: "Adam Smith"}, {ID: 3, Name: "Grace Hopper"}, {ID: 4, Name: "Ruth Adams"},
+		{ID: 5, Name: `<img src=x onerror="alert(1)">Grace`},
+	}}
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Search: search})
+
+	w := sendJSON(r, http.MethodGet, "/users/search?q=ada&size=2", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page repository.SearchPage[model.User]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, "Ada Lovelace", page.Data[0].Entity.Name)
+	assert.Equal(t, "<mark>Ada</mark> Lovelace", page.Data[0].Highlights["name"])
+	assert.Equal(t, repository.SearchQuery{Text: "ada", Limit: 2}, search.last)
+	require.NotEmpty(t, page.NextCursor)
+
+	w = sendJSON(r, http.MethodGet, "/users/search?q=ada&size=2&cursor="+url.QueryEscape(page.NextCursor), nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	page = repository.SearchPage[model.User]{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "Ruth <mark>Ada</mark>ms", page.Data[0].Highlights["name"])
+	assert.Empty(t, page.NextCursor)
+
+	w = sendJSON(r, http.MethodGet, "/users/search?q=grace", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	page = repository.SearchPage[model.User]{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;<mark>Grace</mark>", page.Data[1].Highlights["name"],
+		"the text around the marks is escaped")
+
+	problem(t, sendJSON(r, http.MethodGet, "/users/search?q=%20", nil, nil), http.StatusBadRequest)
+	problem(t, sendJSON(r, http.MethodGet, "/users/search?q="+strings.Repeat("a", 201), nil, nil), http.StatusBadRequest)
+	problem(t, sendJSON(r, http.MethodGet, "/users/search?q=ada&cursor=nope", nil, nil), http.StatusBadRequest)
+}
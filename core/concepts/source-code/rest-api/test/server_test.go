@@ -0,0 +1,123 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rest-api/router"
+	"rest-api/server"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingPinger struct{}
+
+func (failingPinger) PingContext(context.Context) error { return errors.New("connection refused") }
+
+func TestHealth(t *testing.T) {
+	probe := &server.Probe{DB: testDB()}
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Probe: probe})
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.JSONEq(t, `{"status":"ok"}`, w.Body.String(), path)
+	}
+
+	probe.Drain()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, "the server is shutting down", problem(t, w, http.StatusServiceUnavailable).Detail)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "a draining server is still alive")
+}
+
+func TestReady_DatabaseDown(t *testing.T) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys, Probe: &server.Probe{DB: failingPinger{}}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	p := problem(t, w, http.StatusServiceUnavailable)
+	assert.Equal(t, "the database is unreachable", p.Detail)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+}
+
+func TestServer_DrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	probe := &server.Probe{DB: testDB()}
+	r := gin.New()
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	r.GET("/readyz", probe.Ready)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "http://" + ln.Addr().String()
+	srv := &server.Server{HTTP: &http.Server{Handler: r}, Probe: probe, ShutdownTimeout: 5 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{string(body), err}
+	}()
+	<-started
+	cancel()
+
+	res := <-slow
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body, "the in-flight request completes")
+	require.NoError(t, <-served)
+
+	_, err = http.Get(url + "/slow")
+	assert.Error(t, err, "no connection is accepted after the shutdown")
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	r := gin.New()
+	r.GET("/stuck", func(c *gin.Context) {
+		close(started)
+		<-release
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &server.Server{HTTP: &http.Server{Handler: r}, ShutdownTimeout: 50 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, ln) }()
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+	<-started
+	cancel()
+
+	assert.ErrorIs(t, <-served, context.DeadlineExceeded)
+}
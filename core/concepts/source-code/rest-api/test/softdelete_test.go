@@ -0,0 +1,108 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listUserIDs(t *testing.T, q url.Values, admin bool) []int {
+	t.Helper()
+	r, _ := setupRouter()
+	req := httptest.NewRequest("GET", "/users?"+q.Encode(), nil)
+	if admin {
+		req.Header.Set("Authorization", "Bearer "+token(t, "admin"))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var page usersPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	var ids []int
+	for _, u := range page.Data {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	name := fmt.Sprintf("soft-%d", time.Now().UnixNano())
+	user := model.User{Name: name}
+	require.NoError(t, repo.Create(ctx, &user))
+	assert.False(t, user.CreatedAt.IsZero())
+	assert.Equal(t, user.CreatedAt, user.UpdatedAt)
+	assert.Nil(t, user.DeletedAt)
+
+	_, r := setupRouter()
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/users/%d", user.ID), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, err := repo.GetByID(ctx, user.ID)
+	assert.Error(t, err, "soft-deleted rows are hidden from reads")
+
+	q := url.Values{"filter[name]": {name}, "include_deleted": {"true"}}
+	assert.Empty(t, listUserIDs(t, q, false), "include_deleted is reserved to admins")
+	assert.Equal(t, []int{user.ID}, listUserIDs(t, q, true))
+
+	req = httptest.NewRequest("POST", fmt.Sprintf("/users/%d/restore", user.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	restored, err := repo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+
+	require.NoError(t, repo.HardDelete(ctx, user.ID))
+	assert.Empty(t, listUserIDs(t, q, true))
+	assert.ErrorIs(t, repo.Restore(ctx, user.ID), sql.ErrNoRows)
+}
+
+func TestGetUsers_CursorOnTimestamps(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	name := fmt.Sprintf("stamp-%d", time.Now().UnixNano())
+	var want []int
+	for i := 0; i < 3; i++ {
+		u := model.User{Name: name}
+		require.NoError(t, repo.Create(ctx, &u))
+		want = append(want, u.ID)
+	}
+
+	var got []int
+	q := url.Values{"filter[name]": {name}, "sort": {"created_at"}, "size": {"1"}}
+	r, _ := setupRouter()
+	for {
+		req := httptest.NewRequest("GET", "/users?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var page usersPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		for _, u := range page.Data {
+			got = append(got, u.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Set("cursor", page.NextCursor)
+	}
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest-api/repository"
+	"rest-api/router"
+	"rest-api/telemetry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func observeRepositories(t *testing.T) {
+	repository.DefaultObserver = telemetry.Repository
+	t.Cleanup(func() { repository.DefaultObserver = nil })
+}
+
+func TestMetrics(t *testing.T) {
+	observeRepositories(t)
+	require.NoError(t, telemetry.RegisterDB(testDB().DB, "test"))
+	require.NoError(t, telemetry.RegisterDB(testDB().DB, "test"), "registering twice is a no-op")
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/424242", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/users/:id",status="404"}`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/users/:id"}`)
+	assert.Contains(t, body, `http_requests_in_flight{method="GET",route="/metrics"} 1`)
+	assert.Contains(t, body, `db_query_duration_seconds_count{op="GetByID",table="users"}`)
+	assert.Contains(t, body, `go_sql_open_connections{db_name="test"}`)
+}
+
+func TestTracing_PropagatesTraceContext(t *testing.T) {
+	observeRepositories(t)
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys})
+
+	req := httptest.NewRequest("GET", "/users/424242", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	repo, server := spans[0], spans[1]
+	assert.Equal(t, "GET /users/:id", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Equal(t, "users.GetByID", repo.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), repo.Parent.SpanID())
+}
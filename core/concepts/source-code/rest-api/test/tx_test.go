@@ -0,0 +1,84 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"rest-api/model"
+	"rest-api/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countUsers(t *testing.T, repo *repository.SQLRepository[model.User], name string) int {
+	t.Helper()
+	page, err := repo.List(context.Background(), repository.Query{
+		Filters:        []repository.Filter{{Field: "name", Op: repository.OpEq, Value: name}},
+		AllowedFilters: []string{"name"},
+	})
+	require.NoError(t, err)
+	return len(page.Data)
+}
+
+func TestWithTx(t *testing.T) {
+	db := testDB()
+	uow := repository.UnitOfWork{DB: db}
+	repo := &repository.SQLRepository[model.User]{DB: db, Table: "users"}
+	ctx := context.Background()
+	name := func(s string) string { return fmt.Sprintf("tx-%s-%d", s, time.Now().UnixNano()) }
+
+	t.Run("commit", func(t *testing.T) {
+		n := name("commit")
+		err := uow.WithTx(ctx, func(tx *repository.Tx) error {
+			users := repo.InTx(tx)
+			if err := users.Create(ctx, &model.User{Name: n}); err != nil {
+				return err
+			}
+			return users.Create(ctx, &model.User{Name: n})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, countUsers(t, repo, n))
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		n := name("error")
+		boom := errors.New("boom")
+		err := uow.WithTx(ctx, func(tx *repository.Tx) error {
+			require.NoError(t, repo.InTx(tx).Create(ctx, &model.User{Name: n}))
+			return boom
+		})
+		assert.ErrorIs(t, err, boom)
+		assert.Equal(t, 0, countUsers(t, repo, n))
+	})
+
+	t.Run("rollback on panic", func(t *testing.T) {
+		n := name("panic")
+		assert.Panics(t, func() {
+			uow.WithTx(ctx, func(tx *repository.Tx) error {
+				require.NoError(t, repo.InTx(tx).Create(ctx, &model.User{Name: n}))
+				panic("boom")
+			})
+		})
+		assert.Equal(t, 0, countUsers(t, repo, n))
+	})
+
+	t.Run("savepoint", func(t *testing.T) {
+		outer, inner := name("outer"), name("inner")
+		err := uow.WithTx(ctx, func(tx *repository.Tx) error {
+			require.NoError(t, repo.InTx(tx).Create(ctx, &model.User{Name: outer}))
+			nested := tx.WithTx(ctx, func(tx *repository.Tx) error {
+				require.NoError(t, repo.InTx(tx).Create(ctx, &model.User{Name: inner}))
+				return errors.New("discard inner")
+			})
+			assert.Error(t, nested)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, countUsers(t, repo, outer))
+		assert.Equal(t, 0, countUsers(t, repo, inner))
+	})
+}
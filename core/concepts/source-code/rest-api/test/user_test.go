@@ -2,13 +2,21 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
-	"rest-api/config"
+	"rest-api/auth"
 	"rest-api/handler"
+	"rest-api/middleware"
+	"rest-api/model"
+	"rest-api/repository"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -20,16 +28,20 @@ type User struct {
 }
 
 func setupRouter() (*gin.Engine, *gin.Engine) {
-	db := config.InitDB()
+	db := testDB()
 	public := gin.Default()
 	protected := gin.Default()
+	public.Use(middleware.Errors(), middleware.OptionalAuth(auth.Authenticator{Keys: testKeys}))
+	protected.Use(middleware.Errors())
 
 	public.GET("/users", handler.GetUsers(db))
 	public.GET("/users/:id", handler.GetUserByID(db))
 
 	protected.POST("/users", handler.CreateUser(db))
 	protected.PUT("/users/:id", handler.UpdateUser(db))
+	protected.PATCH("/users/:id", handler.PatchUser(db))
 	protected.DELETE("/users/:id", handler.DeleteUser(db))
+	protected.POST("/users/:id/restore", handler.RestoreUser(db))
 
 	return public, protected
 }
@@ -40,12 +52,36 @@ func TestCreateUser(t *testing.T) {
 	body, _ := json.Marshal(user)
 	req := httptest.NewRequest("POST", "/users", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Authorization", "Bearer "+token(t, "admin"))
 
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, "John", created.Name)
+}
+
+func TestCreateUser_IgnoresID(t *testing.T) {
+	_, r := setupRouter()
+	first := sendJSON(r, "POST", "/users", gin.H{"name": "First"}, map[string]string{"Authorization": "Bearer " + token(t, "admin")})
+	assert.Equal(t, http.StatusCreated, first.Code)
+	var existing User
+	assert.NoError(t, json.Unmarshal(first.Body.Bytes(), &existing))
+
+	w := sendJSON(r, "POST", "/users", gin.H{"id": existing.ID, "name": "Second"}, map[string]string{"Authorization": "Bearer " + token(t, "admin")})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEqual(t, existing.ID, created.ID, "the id is generated")
+	assert.Equal(t, "Second", created.Name, "the new row is returned")
+
+	stored, err := handler.Users(testDB()).GetByID(context.Background(), existing.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "First", stored.Name)
 }
 
 func TestGetUsers(t *testing.T) {
@@ -72,20 +108,120 @@ func TestUpdateUser(t *testing.T) {
 	body, _ := json.Marshal(user)
 	req := httptest.NewRequest("PUT", "/users/1", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Authorization", "Bearer "+token(t, "admin"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
 
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+}
+
+func TestUpdateUser_ReturnsEntity(t *testing.T) {
+	_, r := setupRouter()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	user := model.User{Name: "Before"}
+	assert.NoError(t, repo.Create(context.Background(), &user))
+
+	body, _ := json.Marshal(User{Name: "After"})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/users/%d", user.ID), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
-	assert.Contains(t, []int{http.StatusOK, http.StatusInternalServerError}, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var updated User
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, User{ID: user.ID, Name: "After"}, updated)
+}
+
+func TestUpdateUser_StaleVersion(t *testing.T) {
+	public, protected := setupRouter()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	user := model.User{Name: "Shared"}
+	assert.NoError(t, repo.Create(context.Background(), &user))
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/users/%d", user.ID), nil)
+	w := httptest.NewRecorder()
+	public.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	put := func(name string) int {
+		body, _ := json.Marshal(User{Name: name})
+		req := httptest.NewRequest("PUT", fmt.Sprintf("/users/%d", user.ID), bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", etag)
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, put("first writer"))
+	assert.Equal(t, http.StatusPreconditionFailed, put("second writer"))
+
+	got, err := repo.GetByID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "first writer", got.Name)
+	assert.Equal(t, 2, got.Version)
 }
 
 func TestDeleteUser(t *testing.T) {
 	_, r := setupRouter()
-	req := httptest.NewRequest("DELETE", "/users/1", nil)
-	req.Header.Set("Authorization", "Bearer secret-token")
+	user := model.User{Name: "Doomed"}
+	assert.NoError(t, handler.Users(testDB()).Create(context.Background(), &user))
+	admin := map[string]string{"Authorization": "Bearer " + token(t, "admin")}
+
+	w := sendJSON(r, "DELETE", fmt.Sprintf("/users/%d", user.ID), nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = sendJSON(r, "DELETE", fmt.Sprintf("/users/%d", user.ID), nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code, "the user is already deleted")
+	w = sendJSON(r, "DELETE", "/users/999999", nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetUsers_Timeout(t *testing.T) {
+	t.Parallel()
+	r := gin.New()
+	r.Use(middleware.Errors(), middleware.QueryTimeout(time.Nanosecond))
+	r.GET("/users", handler.GetUsers(testDB()))
+
+	req := httptest.NewRequest("GET", "/users", nil)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
-	assert.Contains(t, []int{http.StatusOK, http.StatusInternalServerError}, w.Code)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestGetUsers_Canceled(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	r := gin.New()
+	r.Use(middleware.Errors())
+	r.GET("/users", handler.GetUsers(testDB()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/users", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, middleware.StatusClientClosedRequest, w.Code)
+	assert.Empty(t, logs.String(), "a client that went away is no server error")
+}
+
+func TestUpdateUser_IfMatchAny(t *testing.T) {
+	_, r := setupRouter()
+	repo := repository.SQLRepository[model.User]{DB: testDB(), Table: "users"}
+	user := model.User{Name: "Before"}
+	assert.NoError(t, repo.Create(context.Background(), &user))
+	assert.NoError(t, repo.Update(context.Background(), user.ID, &user))
+
+	w := sendJSON(r, "PUT", fmt.Sprintf("/users/%d", user.ID), gin.H{"name": "After"}, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = sendJSON(r, "PUT", "/users/999999", gin.H{"name": "Nobody"}, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
 }
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rest-api/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sendUser(r http.Handler, method, path, lang string, body any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	if lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func validationErrors(t *testing.T, w *httptest.ResponseRecorder) []validation.FieldError {
+	t.Helper()
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	var body struct {
+		Errors []validation.FieldError `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.Errors
+}
+
+func TestValidation_FieldErrors(t *testing.T) {
+	_, r := setupRouter()
+
+	errs := validationErrors(t, sendUser(r, "POST", "/users", "", gin.H{"name": "J", "email": "not-an-email"}))
+	assert.Equal(t, []validation.FieldError{
+		{Field: "name", Rule: "min", Message: "name must be at least 2 characters in length"},
+		{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+	}, errs)
+
+	errs = validationErrors(t, sendUser(r, "POST", "/users", "fr-CH, fr;q=0.9, en;q=0.8", gin.H{}))
+	assert.Equal(t, []validation.FieldError{
+		{Field: "name", Rule: "required", Message: "name est un champ obligatoire"},
+	}, errs)
+}
+
+func TestValidation_Unique(t *testing.T) {
+	_, r := setupRouter()
+	email := fmt.Sprintf("%s@example.com", t.Name())
+
+	w := sendUser(r, "POST", "/users", "", gin.H{"name": "First", "email": email})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var first User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+
+	errs := validationErrors(t, sendUser(r, "POST", "/users", "fr", gin.H{"name": "Second", "email": email}))
+	assert.Equal(t, []validation.FieldError{{Field: "email", Rule: "unique", Message: "email est déjà utilisé"}}, errs)
+
+	w = sendUser(r, "PUT", fmt.Sprintf("/users/%d", first.ID), "", gin.H{"name": "First renamed", "email": email})
+	assert.Equal(t, http.StatusOK, w.Code, "a row does not conflict with itself")
+}
+
+func TestValidation_MalformedBody(t *testing.T) {
+	_, r := setupRouter()
+	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(`{"name":`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestValidation_Language(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                        "en",
+		"fr":                      "fr",
+		"de-DE, fr;q=0.5":         "fr",
+		"fr;q=0.2, en-GB;q=0.8":   "en",
+		"fr;q=0, es":              "en",
+		"FR-be,de;q=0.7,en;q=0.3": "fr",
+	} {
+		assert.Equal(t, want, validation.Language(header), header)
+	}
+}
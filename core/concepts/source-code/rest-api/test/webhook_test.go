@@ -0,0 +1,336 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"rest-api/auth"
+	"rest-api/model"
+	"rest-api/repository"
+	"rest-api/router"
+	"rest-api/webhook"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hookSecret = "0123456789abcdef-secret"
+
+// newWebhook stores a webhook for the test alone, removed with its
+// deliveries at the end.
+func newWebhook(t *testing.T, url string, events ...string) model.Webhook {
+	t.Helper()
+	hook := model.Webhook{URL: url, Events: events, Secret: hookSecret, Owner: "tester"}
+	repo := &repository.SQLRepository[model.Webhook]{DB: testDB(), Table: "webhooks"}
+	require.NoError(t, repo.Create(context.Background(), &hook))
+	t.Cleanup(func() {
+		testDB().MustExec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", hook.ID)
+		testDB().MustExec("DELETE FROM webhooks WHERE id = ?", hook.ID)
+	})
+	return hook
+}
+
+// hookBearer authenticates subject with the webhook scopes, which JWTs must
+// list.
+func hookBearer(t *testing.T, subject string, roles ...string) map[string]string {
+	t.Helper()
+	scopes := []string{auth.ScopeWebhooksRead, auth.ScopeWebhooksWrite}
+	return map[string]string{"Authorization": "Bearer " + scopedToken(t, subject, scopes, roles...)}
+}
+
+func hookDeliveries(t *testing.T, hook model.Webhook) []model.WebhookDelivery {
+	t.Helper()
+	var deliveries []model.WebhookDelivery
+	require.NoError(t, testDB().Select(&deliveries, "SELECT * FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id", hook.ID))
+	return deliveries
+}
+
+func testEvent(eventType string) repository.Event {
+	return repository.Event{
+		ID:          time.Now().UnixNano(),
+		Type:        eventType,
+		Aggregate:   "users",
+		AggregateID: "1",
+		Payload:     repository.RawJSON(`{"id":1}`),
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// receiver records the deliveries it accepts, and answers status.
+type receiver struct {
+	mu     sync.Mutex
+	status int
+	bodies [][]byte
+	errs   []error
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if err := webhook.Verify(hookSecret, r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+		rc.errs = append(rc.errs, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	header := webhook.Sign(hookSecret, time.Now(), body)
+	assert.NoError(t, webhook.Verify(hookSecret, header, body, time.Minute))
+	assert.ErrorIs(t, webhook.Verify(hookSecret, header, []byte(`{"id":2}`), time.Minute), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify("another secret", header, body, time.Minute), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify(hookSecret, "v1=abc", body, time.Minute), webhook.ErrInvalidSignature)
+
+	old := webhook.Sign(hookSecret, time.Now().Add(-time.Hour), body)
+	assert.Error(t, webhook.Verify(hookSecret, old, body, time.Minute), "replayed")
+}
+
+func TestWebhookMatches(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		want     bool
+	}{
+		{[]string{"users.created"}, true},
+		{[]string{"users.updated"}, false},
+		{[]string{"users.*"}, true},
+		{[]string{"products.*"}, false},
+		{[]string{"products.created", "*"}, true},
+		{nil, false},
+	} {
+		assert.Equal(t, tc.want, webhook.Matches(tc.patterns, "users.created"), "%v", tc.patterns)
+	}
+}
+
+func TestWebhooks_CRUD(t *testing.T) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys})
+	bearer := hookBearer(t, "tester")
+
+	w := sendJSON(r, http.MethodPost, "/webhooks", map[string]any{
+		"url": "https://example.com/hooks", "events": []string{"users.*"}, "secret": hookSecret,
+	}, bearer)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), hookSecret)
+	var hook model.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	t.Cleanup(func() { testDB().MustExec("DELETE FROM webhooks WHERE id = ?", hook.ID) })
+	assert.Equal(t, []string{"users.*"}, []string(hook.Events))
+
+	w = sendJSON(r, http.MethodGet, fmt.Sprintf("/webhooks/%d", hook.ID), nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), hookSecret)
+	w = sendJSON(r, http.MethodGet, "/webhooks", nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), hookSecret)
+
+	w = sendJSON(r, http.MethodPost, "/webhooks", map[string]any{
+		"url": "https://example.com/hooks", "events": []string{"Users created"}, "secret": hookSecret,
+	}, bearer)
+	p := problem(t, w, http.StatusUnprocessableEntity)
+	require.NotEmpty(t, p.Errors)
+	assert.Equal(t, "eventtype", p.Errors[0].Rule)
+
+	for _, url := range []string{"http://example.com/hooks", "https://169.254.169.254/latest", "https://localhost:8080/"} {
+		w = sendJSON(r, http.MethodPost, "/webhooks", map[string]any{
+			"url": url, "events": []string{"users.*"}, "secret": hookSecret,
+		}, bearer)
+		p = problem(t, w, http.StatusUnprocessableEntity)
+		require.NotEmpty(t, p.Errors, url)
+		assert.Equal(t, "webhookurl", p.Errors[0].Rule, url)
+	}
+
+	problem(t, sendJSON(r, http.MethodGet, "/webhooks", nil, nil), http.StatusUnauthorized)
+}
+
+func TestWebhooks_FanoutAndDeliver(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{status: http.StatusNoContent}
+	srv := httptest.NewTLSServer(rc)
+	defer srv.Close()
+	users := newWebhook(t, srv.URL, "users.*")
+	products := newWebhook(t, srv.URL, "products.created")
+
+	fanout := webhook.Fanout{DB: testDB()}
+	event := testEvent("users.created")
+	require.NoError(t, fanout.Send(ctx, event))
+	require.NoError(t, fanout.Send(ctx, event), "a redispatched event is queued once")
+	require.Len(t, hookDeliveries(t, users), 1)
+	assert.Empty(t, hookDeliveries(t, products))
+
+	d := &webhook.Deliverer{DB: testDB(), Client: srv.Client()}
+	n, err := d.DeliverOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	require.Empty(t, rc.errs)
+	require.Len(t, rc.bodies, 1)
+	var got repository.Event
+	require.NoError(t, json.Unmarshal(rc.bodies[0], &got))
+	assert.Equal(t, event.ID, got.ID)
+	assert.Equal(t, "users.created", got.Type)
+
+	delivery := hookDeliveries(t, users)[0]
+	assert.Equal(t, model.DeliverySucceeded, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.LastStatus)
+	assert.NotNil(t, delivery.DeliveredAt)
+
+	n, err = d.DeliverOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "delivered once")
+}
+
+func TestWebhooks_DeadLetterAndRetry(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{status: http.StatusInternalServerError}
+	srv := httptest.NewTLSServer(rc)
+	defer srv.Close()
+	hook := newWebhook(t, srv.URL, "*")
+	require.NoError(t, webhook.Fanout{DB: testDB()}.Send(ctx, testEvent("products.deleted")))
+
+	d := &webhook.Deliverer{DB: testDB(), Client: srv.Client(), MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }}
+	for range 2 {
+		_, err := d.DeliverOnce(ctx)
+		require.NoError(t, err)
+	}
+	assert.Len(t, rc.bodies, 2)
+	delivery := hookDeliveries(t, hook)[0]
+	assert.Equal(t, model.DeliveryDead, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Contains(t, delivery.LastError, "500")
+
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys})
+	bearer := hookBearer(t, "tester")
+	w := sendJSON(r, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries?filter[status]=dead", hook.ID), nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page repository.Page[model.WebhookDelivery]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, delivery.ID, page.Data[0].ID)
+	assert.Equal(t, http.StatusInternalServerError, page.Data[0].LastStatus)
+
+	retry := fmt.Sprintf("/webhooks/%d/deliveries/%d/retry", hook.ID, delivery.ID)
+	w = sendJSON(r, http.MethodPost, retry, nil, bearer)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	problem(t, sendJSON(r, http.MethodPost, retry, nil, bearer), http.StatusConflict)
+	problem(t, sendJSON(r, http.MethodPost, fmt.Sprintf("/webhooks/%d/deliveries/%d/retry", hook.ID+1000, delivery.ID), nil, bearer), http.StatusNotFound)
+	other := newWebhook(t, srv.URL, "*")
+	problem(t, sendJSON(r, http.MethodPost, fmt.Sprintf("/webhooks/%d/deliveries/%d/retry", other.ID, delivery.ID), nil, bearer), http.StatusNotFound)
+	assert.Equal(t, model.DeliveryPending, hookDeliveries(t, hook)[0].Status, "a pending delivery is left alone")
+
+	rc.mu.Lock()
+	rc.status = http.StatusOK
+	rc.mu.Unlock()
+	n, err := d.DeliverOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, model.DeliverySucceeded, hookDeliveries(t, hook)[0].Status)
+}
+
+func TestWebhookCheckURL(t *testing.T) {
+	ctx := context.Background()
+	for _, url := range []string{
+		"http://93.184.215.14/hooks",
+		"https://127.0.0.1/hooks",
+		"https://[::1]/hooks",
+		"https://10.1.2.3/hooks",
+		"https://192.168.0.1/hooks",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[fe80::1]/hooks",
+		"https://[::ffff:127.0.0.1]/hooks",
+		"https://100.64.0.1/hooks",
+		"https://0.0.0.0/hooks",
+		"ftp://93.184.215.14/hooks",
+	} {
+		assert.Error(t, webhook.CheckURL(ctx, url), url)
+	}
+	assert.NoError(t, webhook.CheckURL(ctx, "https://93.184.215.14/hooks"))
+	assert.NoError(t, webhook.CheckURL(ctx, "https://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]/hooks"))
+}
+
+func TestWebhooks_DeliverRefusesInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{status: http.StatusNoContent}
+	srv := httptest.NewTLSServer(rc)
+	defer srv.Close()
+	hook := newWebhook(t, srv.URL, "*")
+	require.NoError(t, webhook.Fanout{DB: testDB()}.Send(ctx, testEvent("users.created")))
+
+	// The default client checks the address it dials, whatever the URL.
+	n, err := (&webhook.Deliverer{DB: testDB()}).DeliverOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, rc.bodies)
+	delivery := hookDeliveries(t, hook)[0]
+	assert.Equal(t, model.DeliveryPending, delivery.Status)
+	assert.Contains(t, delivery.LastError, "forbidden receiver address")
+}
+
+func TestWebhooks_Owner(t *testing.T) {
+	r := router.New(router.Deps{DB: testDB(), Keys: testKeys})
+	alice, bob, admin := hookBearer(t, "alice"), hookBearer(t, "bob"), hookBearer(t, "root", "admin")
+
+	w := sendJSON(r, http.MethodPost, "/webhooks", map[string]any{
+		"url": "https://example.com/alice", "events": []string{"*"}, "secret": hookSecret, "owner": "bob",
+	}, alice)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var hook model.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	t.Cleanup(func() { testDB().MustExec("DELETE FROM webhooks WHERE id = ?", hook.ID) })
+	assert.Equal(t, "alice", hook.Owner, "the owner comes from the credentials")
+	path := fmt.Sprintf("/webhooks/%d", hook.ID)
+
+	ids := func(bearer map[string]string) []int {
+		w := sendJSON(r, http.MethodGet, "/webhooks?size=100", nil, bearer)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var page repository.Page[model.Webhook]
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		var ids []int
+		for _, h := range page.Data {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+	assert.Contains(t, ids(alice), hook.ID)
+	assert.NotContains(t, ids(bob), hook.ID)
+
+	update := map[string]any{"url": "https://example.com/bob", "events": []string{"*"}, "secret": hookSecret}
+	ifMatch := map[string]string{"If-Match": `"1"`}
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, path},
+		{http.MethodPut, path},
+		{http.MethodPatch, path},
+		{http.MethodDelete, path},
+		{http.MethodGet, path + "/deliveries"},
+		{http.MethodPost, path + "/deliveries/1/retry"},
+	} {
+		header := map[string]string{}
+		for _, h := range []map[string]string{bob, ifMatch} {
+			for k, v := range h {
+				header[k] = v
+			}
+		}
+		problem(t, sendJSON(r, req.method, req.path, update, header), http.StatusNotFound)
+	}
+
+	w = sendJSON(r, http.MethodPatch, path, map[string]any{"paused": true}, map[string]string{
+		"Authorization": admin["Authorization"], "If-Match": `"1"`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	assert.True(t, hook.Paused)
+	assert.Equal(t, "alice", hook.Owner, "admins act on every webhook and keep its owner")
+
+	user := map[string]string{"Authorization": "Bearer " + token(t)}
+	problem(t, sendJSON(r, http.MethodGet, "/webhooks", nil, user), http.StatusForbidden)
+}
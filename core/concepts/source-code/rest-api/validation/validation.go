@@ -0,0 +1,236 @@
+// Package validation checks request bodies against their binding tags and
+// reports failures field by field, in English or French.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+)
+
+// Languages lists the supported languages, the first being the default.
+var Languages = []string{"en", "fr"}
+
+// FieldError is one failed rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is returned when a value breaks one or more rules.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator implements gin's binding.StructValidator on top of a shared
+// validator.Validate, with the custom rules and translations registered.
+type Validator struct {
+	validate *validator.Validate
+	uni      *ut.UniversalTranslator
+}
+
+// Default is installed as gin's binding.Validator by the handlers.
+var Default = newValidator()
+
+func newValidator() *Validator {
+	v := &Validator{
+		validate: validator.New(validator.WithRequiredStructEnabled()),
+		uni:      ut.New(en.New(), en.New(), fr.New()),
+	}
+	v.validate.SetTagName("binding")
+	v.validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return f.Name
+		}
+		return name
+	})
+
+	enTrans, _ := v.uni.GetTranslator("en")
+	frTrans, _ := v.uni.GetTranslator("fr")
+	if err := en_translations.RegisterDefaultTranslations(v.validate, enTrans); err != nil {
+		panic(err)
+	}
+	if err := fr_translations.RegisterDefaultTranslations(v.validate, frTrans); err != nil {
+		panic(err)
+	}
+
+	// unique needs the database, so CheckUnique runs it after the other
+	// rules; the tag is only registered to be accepted here.
+	v.mustRegister("unique", func(validator.FieldLevel) bool { return true }, map[string]string{
+		"en": "{0} is already taken",
+		"fr": "{0} est déjà utilisé",
+	})
+	return v
+}
+
+func (v *Validator) ValidateStruct(obj any) error {
+	val := reflect.ValueOf(obj)
+	for val.Kind() == reflect.Pointer && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+	return v.validate.Struct(obj)
+}
+
+func (v *Validator) Engine() any {
+	return v.validate
+}
+
+// RegisterRule adds a rule usable in binding tags, with its message in each
+// language. Messages refer to the field as {0} and to the rule parameter as
+// {1}.
+func RegisterRule(tag string, fn validator.Func, messages map[string]string) error {
+	return Default.register(tag, fn, messages)
+}
+
+func (v *Validator) mustRegister(tag string, fn validator.Func, messages map[string]string) {
+	if err := v.register(tag, fn, messages); err != nil {
+		panic(err)
+	}
+}
+
+func (v *Validator) register(tag string, fn validator.Func, messages map[string]string) error {
+	if err := v.validate.RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	for _, lang := range Languages {
+		msg, ok := messages[lang]
+		if !ok {
+			return fmt.Errorf("validation: rule %q has no %s message", tag, lang)
+		}
+		trans, _ := v.uni.GetTranslator(lang)
+		err := v.validate.RegisterTranslation(tag, trans,
+			func(t ut.Translator) error { return t.Add(tag, msg, true) },
+			func(t ut.Translator, fe validator.FieldError) string {
+				s, _ := t.T(tag, fe.Field(), fe.Param())
+				return s
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Translate turns the errors returned by ValidateStruct into field errors
+// worded in lang. It reports false for any other error.
+func Translate(err error, lang string) (Errors, bool) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil, false
+	}
+	trans, _ := Default.uni.GetTranslator(lang)
+	out := make(Errors, len(verrs))
+	for i, fe := range verrs {
+		out[i] = FieldError{Field: fieldPath(fe), Rule: fe.Tag(), Message: fe.Translate(trans)}
+	}
+	return out, true
+}
+
+// fieldPath drops the struct name from the namespace, so nested fields read
+// "address.city" and list items "scopes[1]".
+func fieldPath(fe validator.FieldError) string {
+	_, path, ok := strings.Cut(fe.Namespace(), ".")
+	if !ok {
+		return fe.Field()
+	}
+	return path
+}
+
+// UniqueFunc reports whether value is already used in column by another row.
+type UniqueFunc func(ctx context.Context, column string, value any) (bool, error)
+
+// CheckUnique runs the unique rule of obj's fields through taken. Fields are
+// matched to columns through their db tag, and empty fields are skipped.
+func CheckUnique(ctx context.Context, obj any, lang string, taken UniqueFunc) (Errors, error) {
+	val := reflect.Indirect(reflect.ValueOf(obj))
+	typ := val.Type()
+	trans, _ := Default.uni.GetTranslator(lang)
+	var out Errors
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !hasRule(f.Tag.Get("binding"), "unique") || val.Field(i).IsZero() {
+			continue
+		}
+		column, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if column == "" {
+			column = strings.ToLower(f.Name)
+		}
+		used, err := taken(ctx, column, val.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" {
+				name = f.Name
+			}
+			msg, _ := trans.T("unique", name)
+			out = append(out, FieldError{Field: name, Rule: "unique", Message: msg})
+		}
+	}
+	return out, nil
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Language picks the supported language the client prefers most from an
+// Accept-Language header.
+func Language(acceptLanguage string) string {
+	type pref struct {
+		lang string
+		q    float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		prefs = append(prefs, pref{base, q})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	for _, p := range prefs {
+		for _, lang := range Languages {
+			if p.lang == lang && p.q > 0 {
+				return lang
+			}
+		}
+	}
+	return Languages[0]
+}
@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"rest-api/validation"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrForbiddenAddress is returned for receivers that are not public hosts:
+// loopback, private, link-local and other special addresses are refused so
+// that webhooks cannot reach the internal network.
+var ErrForbiddenAddress = errors.New("webhook: forbidden receiver address")
+
+// reserved lists the special ranges that Allowed refuses on top of the
+// ones netip classifies.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+func init() {
+	err := validation.RegisterRule("webhookurl", func(fl validator.FieldLevel) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		return CheckURL(ctx, fl.Field().String()) == nil
+	}, map[string]string{
+		"en": "{0} must be an https URL of a public host",
+		"fr": "{0} doit être une URL https d'un hôte public",
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Allowed reports whether ip is a public unicast address.
+func Allowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL accepts https URLs whose host is, or resolves to, public
+// addresses only. Hosts that do not resolve are accepted, since the address
+// is checked again when dialing.
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("webhook: %q is not an https URL", raw)
+	}
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !Allowed(ip) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+		}
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if !Allowed(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, u.Hostname(), ip)
+		}
+	}
+	return nil
+}
+
+// Control refuses connections to addresses that are not Allowed. It runs
+// on the resolved address of each dial, so that a host resolving to another
+// address after registration, as in DNS rebinding, is refused too.
+func Control(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !Allowed(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ap.Addr())
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with by default. It
+// dials public addresses only, ignores proxy settings, which would hide the
+// receiver address, and does not follow redirects.
+func NewClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, Control: Control}).DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"rest-api/model"
+	"rest-api/outbox"
+	"rest-api/repository"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// Deliverer sends the pending deliveries of active webhooks. A delivery
+// succeeds on a 2xx response; otherwise it is retried with exponential
+// backoff until MaxAttempts, after which it is dead.
+type Deliverer struct {
+	DB *sqlx.DB
+	// Client defaults to NewClient with a 10s timeout, which only dials
+	// public addresses.
+	Client *http.Client
+	// Interval between polls, 1s by default.
+	Interval time.Duration
+	// BatchSize bounds the deliveries sent per poll, 100 by default.
+	BatchSize int
+	// MaxAttempts defaults to 8.
+	MaxAttempts int
+	// Backoff is the wait after the given failed attempt, by default 30s
+	// doubled per attempt up to 6 hours.
+	Backoff func(attempt int) time.Duration
+	// Lease hides a claimed delivery from other deliverers while it is
+	// sent, 1m by default.
+	Lease time.Duration
+}
+
+var defaultClient = NewClient(10 * time.Second)
+
+// pending is a delivery with what is needed to send it.
+type pending struct {
+	model.WebhookDelivery
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+// Run delivers until ctx is done.
+func (d *Deliverer) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhook: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverOnce sends one batch of due deliveries and returns how many
+// succeeded.
+func (d *Deliverer) DeliverOnce(ctx context.Context) (int, error) {
+	batch := d.BatchSize
+	if batch == 0 {
+		batch = 100
+	}
+	dialect := repository.DialectFor(d.DB.DriverName())
+	query, args, err := sq.Select("d.*", "w.url", "w.secret").
+		From("webhook_deliveries d").Join("webhooks w ON w.id = d.webhook_id").
+		Where(sq.Eq{"d.status": model.DeliveryPending, "w.paused": false}).
+		Where(sq.LtOrEq{"d.next_attempt_at": time.Now().UTC()}).
+		OrderBy("d.id").Limit(uint64(batch)).
+		PlaceholderFormat(dialect.Placeholder()).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var due []pending
+	if err := d.DB.SelectContext(ctx, &due, query, args...); err != nil {
+		return 0, err
+	}
+
+	succeeded := 0
+	for _, p := range due {
+		if ctx.Err() != nil {
+			return succeeded, ctx.Err()
+		}
+		claimed, err := d.claim(ctx, p.WebhookDelivery)
+		if err != nil {
+			return succeeded, err
+		}
+		if !claimed {
+			continue
+		}
+		p.Attempts++
+		status, sendErr := d.send(ctx, p)
+		fields := map[string]any{"last_status": status}
+		switch {
+		case sendErr == nil:
+			fields["status"] = model.DeliverySucceeded
+			fields["delivered_at"] = time.Now().UTC()
+			fields["last_error"] = ""
+			succeeded++
+		case p.Attempts >= d.maxAttempts():
+			fields["status"] = model.DeliveryDead
+			fields["last_error"] = sendErr.Error()
+		default:
+			fields["next_attempt_at"] = time.Now().UTC().Add(d.backoff(p.Attempts))
+			fields["last_error"] = sendErr.Error()
+		}
+		if _, err := deliveries(d.DB).UpdateFields(ctx, p.ID, fields); err != nil {
+			return succeeded, err
+		}
+	}
+	return succeeded, nil
+}
+
+func (d *Deliverer) maxAttempts() int {
+	if d.MaxAttempts == 0 {
+		return 8
+	}
+	return d.MaxAttempts
+}
+
+func (d *Deliverer) backoff(attempt int) time.Duration {
+	if d.Backoff != nil {
+		return d.Backoff(attempt)
+	}
+	return outbox.Exponential(30*time.Second, 6*time.Hour)(attempt)
+}
+
+// claim counts the attempt and hides the delivery for the lease, unless
+// another deliverer claimed it first.
+func (d *Deliverer) claim(ctx context.Context, delivery model.WebhookDelivery) (bool, error) {
+	lease := d.Lease
+	if lease == 0 {
+		lease = time.Minute
+	}
+	dialect := repository.DialectFor(d.DB.DriverName())
+	query, args, err := sq.Update("webhook_deliveries").
+		Set("attempts", delivery.Attempts+1).
+		Set("next_attempt_at", time.Now().UTC().Add(lease)).
+		Where(sq.Eq{"id": delivery.ID, "attempts": delivery.Attempts, "status": model.DeliveryPending}).
+		PlaceholderFormat(dialect.Placeholder()).ToSql()
+	if err != nil {
+		return false, err
+	}
+	res, err := d.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// send POSTs the payload, signed with the webhook secret, and returns the
+// response status, 0 when there was none.
+func (d *Deliverer) send(ctx context.Context, p pending) (int, error) {
+	// Webhooks registered before https was required are not sent.
+	if u, err := url.Parse(p.URL); err != nil || u.Scheme != "https" {
+		return 0, fmt.Errorf("webhook: %q is not an https URL", p.URL)
+	}
+	body := []byte(p.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rest-api-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(p.WebhookID))
+	req.Header.Set("X-Delivery-ID", strconv.FormatInt(p.ID, 10))
+	req.Header.Set("X-Event-ID", strconv.FormatInt(p.EventID, 10))
+	req.Header.Set("X-Event-Type", p.EventType)
+	req.Header.Set(SignatureHeader, Sign(p.Secret, time.Now(), body))
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
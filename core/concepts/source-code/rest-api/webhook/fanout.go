@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"rest-api/model"
+	"rest-api/repository"
+	"rest-api/validation"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jmoiron/sqlx"
+)
+
+var eventType = regexp.MustCompile(`^(\*|[a-z][a-z0-9_]*\.(\*|[a-z][a-z0-9_]*))$`)
+
+func init() {
+	err := validation.RegisterRule("eventtype", func(fl validator.FieldLevel) bool {
+		return eventType.MatchString(fl.Field().String())
+	}, map[string]string{
+		"en": "{0} must be an event type such as users.created, users.* or *",
+		"fr": "{0} doit être un type d'événement comme users.created, users.* ou *",
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Matches reports whether eventType is selected by one of patterns, which
+// are event types, "<table>.*" or "*".
+func Matches(patterns []string, eventType string) bool {
+	table, _, _ := strings.Cut(eventType, ".")
+	for _, p := range patterns {
+		if p == "*" || p == eventType || p == table+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+func webhooks(db repository.DBTX) *repository.SQLRepository[model.Webhook] {
+	return &repository.SQLRepository[model.Webhook]{DB: db, Table: "webhooks"}
+}
+
+func deliveries(db repository.DBTX) *repository.SQLRepository[model.WebhookDelivery] {
+	return &repository.SQLRepository[model.WebhookDelivery]{DB: db, Table: "webhook_deliveries"}
+}
+
+// Fanout is an outbox.Sink that queues a delivery of each event for every
+// webhook subscribed to it, paused ones included. It is idempotent, so the
+// outbox may hand it an event again.
+type Fanout struct {
+	DB *sqlx.DB
+}
+
+func (f Fanout) Send(ctx context.Context, e repository.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	q := repository.Query{Limit: repository.MaxLimit}
+	for {
+		page, err := webhooks(f.DB).List(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, hook := range page.Data {
+			if !Matches(hook.Events, e.Type) {
+				continue
+			}
+			if err := f.queue(ctx, hook, e, payload); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func (f Fanout) queue(ctx context.Context, hook model.Webhook, e repository.Event, payload []byte) error {
+	repo := deliveries(f.DB)
+	queued, err := repo.Exists(ctx,
+		repository.Filter{Field: "webhook_id", Op: repository.OpEq, Value: hook.ID},
+		repository.Filter{Field: "event_id", Op: repository.OpEq, Value: e.ID})
+	if err != nil || queued {
+		return err
+	}
+	return repo.Create(ctx, &model.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventID:       e.ID,
+		EventType:     e.Type,
+		Payload:       string(payload),
+		Status:        model.DeliveryPending,
+		NextAttemptAt: time.Now().UTC(),
+	})
+}
@@ -1,29 +1,66 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 	"log"
 
+	"go-sqlite-api/migrations"
+
+	"rest-api/migrate"
+
+	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
+var DB *sqlx.DB
 
-func InitDB(filepath string) {
+// Open connects to the database without touching its schema.
+func Open(filepath string) {
 	var err error
-	DB, err = sql.Open("sqlite3", filepath)
+	DB, err = sqlx.Open("sqlite3", filepath+"?_busy_timeout=5000")
 	if err != nil {
 		log.Fatal(err)
 	}
+}
+
+// Migrator applies the embedded migrations to DB.
+func Migrator() *migrate.Migrator {
+	return &migrate.Migrator{DB: DB, FS: migrations.FS}
+}
+
+// SearchMigrator applies the full-text search migrations to DB. They are
+// recorded apart from the others since only FTS5 builds apply them.
+func SearchMigrator() *migrate.Migrator {
+	return &migrate.Migrator{DB: DB, FS: migrations.Search, Table: "search_migrations"}
+}
+
+// SearchEnabled is set by InitDB when SQLite has FTS5 and the search index
+// is ready.
+var SearchEnabled bool
 
-	createTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT,
-		email TEXT
-	);`
-	_, err = DB.Exec(createTable)
+// HasFTS5 reports whether the SQLite library was compiled with FTS5.
+func HasFTS5(ctx context.Context) (bool, error) {
+	var used bool
+	err := DB.GetContext(ctx, &used, "SELECT sqlite_compileoption_used('ENABLE_FTS5')")
+	return used, err
+}
+
+func InitDB(filepath string) {
+	Open(filepath)
+	ctx := context.Background()
+	if _, err := Migrator().Up(ctx); err != nil {
+		log.Fatal(err)
+	}
+	fts5, err := HasFTS5(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if !fts5 {
+		log.Print("db: SQLite has no FTS5, /users/search is disabled; build with -tags sqlite_fts5 to enable it")
+		return
+	}
+	if _, err := SearchMigrator().Up(ctx); err != nil {
+		log.Fatal(err)
+	}
+	SearchEnabled = true
 }
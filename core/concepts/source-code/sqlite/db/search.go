@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"go-sqlite-api/models"
+
+	"rest-api/repository"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UserSearch searches the names and emails of users with SQLite FTS5,
+// ranked by bm25. The users_fts index is kept up to date by the triggers of
+// the search migrations, which InitDB only applies to builds with the
+// sqlite_fts5 tag.
+type UserSearch struct {
+	DB *sqlx.DB
+}
+
+var _ repository.Searcher[models.User] = UserSearch{}
+
+type userHit struct {
+	models.User
+	Rank           float64 `db:"rank"`
+	NameHighlight  string  `db:"name_highlight"`
+	EmailHighlight string  `db:"email_highlight"`
+}
+
+func (s UserSearch) Search(ctx context.Context, q repository.SearchQuery) (repository.SearchPage[models.User], error) {
+	limit, offset, err := q.Bounds()
+	if err != nil {
+		return repository.SearchPage[models.User]{}, err
+	}
+	match := matchQuery(q.Text)
+	if match == "" {
+		return repository.NewSearchPage[models.User](nil, limit, offset), nil
+	}
+	// bm25 is lower for better matches.
+	var rows []userHit
+	err = s.DB.SelectContext(ctx, &rows, `
+		SELECT u.id, u.name, u.email, -bm25(users_fts) AS rank,
+			coalesce(highlight(users_fts, 0, ?, ?), '') AS name_highlight,
+			coalesce(highlight(users_fts, 1, ?, ?), '') AS email_highlight
+		FROM users_fts JOIN users u ON u.id = users_fts.rowid
+		WHERE users_fts MATCH ?
+		ORDER BY bm25(users_fts), u.id
+		LIMIT ? OFFSET ?`,
+		repository.MatchStart, repository.MatchStop,
+		repository.MatchStart, repository.MatchStop,
+		match, limit+1, offset)
+	if err != nil {
+		return repository.SearchPage[models.User]{}, err
+	}
+	hits := make([]repository.Hit[models.User], len(rows))
+	for i, row := range rows {
+		hits[i] = repository.Hit[models.User]{Entity: row.User, Rank: row.Rank}
+		for column, hl := range map[string]string{"name": row.NameHighlight, "email": row.EmailHighlight} {
+			if marked, ok := repository.Highlight(hl); ok {
+				if hits[i].Highlights == nil {
+					hits[i].Highlights = map[string]string{}
+				}
+				hits[i].Highlights[column] = marked
+			}
+		}
+	}
+	return repository.NewSearchPage(hits, limit, offset), nil
+}
+
+// matchQuery turns text into an FTS5 query matching the rows with every
+// word as a prefix, so that "ada lov" finds "Ada Lovelace". Only letters and
+// digits are kept, leaving no FTS5 syntax to escape.
+func matchQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"*`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,96 @@
+//go:build sqlite_fts5
+
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-sqlite-api/db"
+
+	"rest-api/repository"
+)
+
+// Run with: go test -tags sqlite_fts5 ./db
+func TestUserSearch(t *testing.T) {
+	db.InitDB(filepath.Join(t.TempDir(), "users.db"))
+	t.Cleanup(func() { db.DB.Close() })
+	if !db.SearchEnabled {
+		t.Fatal("search is disabled in an FTS5 build")
+	}
+	ctx := context.Background()
+	for _, name := range []string{"Ada Lovelace", "Adam Smith", "Grace Hopper", "Ruth Adams", "Zoë Ådå", "<b>Ada</b> Fan"} {
+		db.DB.MustExec("INSERT INTO users (name, email) VALUES (?, ?)", name, "someone@example.com")
+	}
+	// The triggers keep the index in sync.
+	db.DB.MustExec("UPDATE users SET name = 'Adele' WHERE name = 'Grace Hopper'")
+	db.DB.MustExec("DELETE FROM users WHERE name = 'Adam Smith'")
+	search := db.UserSearch{DB: db.DB}
+
+	var names []string
+	highlights := map[string]string{}
+	q := repository.SearchQuery{Text: "ad", Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := search.Search(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Data) > 2 {
+			t.Fatalf("page of %d hits, want at most 2", len(page.Data))
+		}
+		for i, h := range page.Data {
+			names = append(names, h.Entity.Name)
+			highlights[h.Entity.Name] = h.Highlights["name"]
+			if i > 0 && h.Rank > page.Data[i-1].Rank {
+				t.Errorf("%q ranks above %q", h.Entity.Name, page.Data[i-1].Entity.Name)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	want := []string{"Ada Lovelace", "Adele", "Ruth Adams", "Zoë Ådå", "<b>Ada</b> Fan"}
+	if !sameElements(names, want) {
+		t.Errorf("found %q, want %q", names, want)
+	}
+	for name, hl := range map[string]string{
+		"Ada Lovelace":   "<mark>Ada</mark> Lovelace",
+		"Ruth Adams":     "Ruth <mark>Adams</mark>",
+		"Zoë Ådå":        "Zoë <mark>Ådå</mark>",
+		"<b>Ada</b> Fan": "&lt;b&gt;<mark>Ada</mark>&lt;/b&gt; Fan",
+	} {
+		if highlights[name] != hl {
+			t.Errorf("highlight of %q is %q, want %q", name, highlights[name], hl)
+		}
+	}
+
+	page, err := search.Search(ctx, repository.SearchQuery{Text: `zoe "ada`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 1 || page.Data[0].Entity.Name != "Zoë Ådå" {
+		t.Errorf("every word must match, without diacritics: got %+v", page.Data)
+	}
+
+	page, err = search.Search(ctx, repository.SearchQuery{Text: "smith"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 0 {
+		t.Errorf("deleted users are found: %+v", page.Data)
+	}
+}
+
+func sameElements(got, want []string) bool {
+	count := func(list []string) map[string]int {
+		m := map[string]int{}
+		for _, s := range list {
+			m[s]++
+		}
+		return m
+	}
+	return reflect.DeepEqual(count(got), count(want))
+}
@@ -2,33 +2,68 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"go-sqlite-api/db"
 	"go-sqlite-api/models"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"rest-api/apperr"
+	"rest-api/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
+func users() *repository.SQLRepository[models.User] {
+	return &repository.SQLRepository[models.User]{DB: db.DB, Table: "users", Dialect: repository.SQLite}
+}
+
+// GetUsers answers GET /users with a page of users in id order, walked with
+// size and next_cursor as in rest-api.
 func GetUsers(c *gin.Context) {
-	rows, err := db.DB.Query("SELECT id, name, email FROM users")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if _, ok := c.GetQuery("page"); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page is not supported, page with size and cursor"})
 		return
 	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var u models.User
-		err := rows.Scan(&u.ID, &u.Name, &u.Email)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	q := repository.Query{Cursor: c.Query("cursor")}
+	if size, ok := c.GetQuery("size"); ok {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be a positive integer"})
 			return
 		}
-		users = append(users, u)
+		q.Limit = n
 	}
-	c.JSON(http.StatusOK, users)
+	page, err := users().List(c.Request.Context(), q)
+	var invalid *apperr.Error
+	if errors.As(err, &invalid) && invalid.Kind == apperr.KindBadRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Detail})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// SearchUsers answers GET /users/search?q=, paged with size and cursor.
+func SearchUsers(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	size, _ := strconv.Atoi(c.Query("size"))
+	page, err := db.UserSearch{DB: db.DB}.Search(c.Request.Context(), repository.SearchQuery{Text: text, Limit: size, Cursor: c.Query("cursor")})
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func CreateUser(c *gin.Context) {
@@ -37,21 +72,16 @@ func CreateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	result, err := db.DB.Exec("INSERT INTO users (name, email) VALUES (?, ?)", u.Name, u.Email)
-	if err != nil {
+	if err := users().Create(c.Request.Context(), &u); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	id, _ := result.LastInsertId()
-	u.ID = int(id)
 	c.JSON(http.StatusOK, u)
 }
 
 func GetUser(c *gin.Context) {
-	id := c.Param("id")
-	var u models.User
-	err := db.DB.QueryRow("SELECT id, name, email FROM users WHERE id = ?", id).Scan(&u.ID, &u.Name, &u.Email)
-	if err == sql.ErrNoRows {
+	u, err := users().GetByID(c.Request.Context(), toInt(c.Param("id")))
+	if errors.Is(err, sql.ErrNoRows) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	} else if err != nil {
@@ -68,19 +98,23 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	_, err := db.DB.Exec("UPDATE users SET name = ?, email = ? WHERE id = ?", u.Name, u.Email, id)
-	if err != nil {
+	err := users().Update(c.Request.Context(), toInt(id), &u)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	u.ID = toInt(id)
 	c.JSON(http.StatusOK, u)
 }
 
 func DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	_, err := db.DB.Exec("DELETE FROM users WHERE id = ?", id)
-	if err != nil {
+	err := users().Delete(c.Request.Context(), toInt(c.Param("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1,12 +1,43 @@
 package main
 
 import (
+	"context"
+	"io"
+	"log"
+	"os"
+
 	"go-sqlite-api/db"
 	"go-sqlite-api/routes"
+
+	"rest-api/migrate"
+	"rest-api/repository"
+	"rest-api/telemetry"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		db.Open("users.db")
+		if err := migrate.Run(context.Background(), db.Migrator(), "migrations", os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	db.InitDB("users.db")
+
+	var traces io.Writer
+	if os.Getenv("TRACE_STDOUT") == "true" {
+		traces = os.Stdout
+	}
+	shutdown, err := telemetry.Setup("go-sqlite-api", traces)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdown(context.Background())
+	repository.DefaultObserver = telemetry.Repository
+	if err := telemetry.RegisterDB(db.DB.DB, "users"); err != nil {
+		log.Fatal(err)
+	}
+
 	r := routes.SetupRouter()
 	r.Run(":8080")
 }
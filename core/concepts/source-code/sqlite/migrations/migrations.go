@@ -0,0 +1,18 @@
+// Package migrations embeds the schema migrations of the SQLite service.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed search/*.sql
+var search embed.FS
+
+// Search holds the full-text search migrations. They need FTS5, which
+// go-sqlite3 only compiles in with the sqlite_fts5 build tag, so they are
+// versioned apart and skipped by builds without it.
+var Search, _ = fs.Sub(search, "search")
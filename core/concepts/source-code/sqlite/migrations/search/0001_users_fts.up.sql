@@ -0,0 +1,15 @@
+-- Applied only when SQLite has FTS5, i.e. builds with -tags sqlite_fts5.
+-- IF NOT EXISTS keeps it idempotent for databases that got the index from
+-- an earlier layout.
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(name, email, content='users', content_rowid='id', tokenize='unicode61 remove_diacritics 2');
+INSERT INTO users_fts (users_fts) VALUES ('rebuild');
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+	INSERT INTO users_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+	INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE ON users BEGIN
+	INSERT INTO users_fts (users_fts, rowid, name, email) VALUES ('delete', old.id, old.name, old.email);
+	INSERT INTO users_fts (rowid, name, email) VALUES (new.id, new.name, new.email);
+END;
@@ -1,16 +1,24 @@
 package routes
 
 import (
+	"go-sqlite-api/db"
 	"go-sqlite-api/handlers"
 
+	"rest-api/telemetry"
+
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
+	r.Use(telemetry.Tracing(), telemetry.Metrics())
+	r.GET("/metrics", telemetry.Handler())
 
 	r.GET("/users", handlers.GetUsers)
 	r.POST("/users", handlers.CreateUser)
+	if db.SearchEnabled {
+		r.GET("/users/search", handlers.SearchUsers)
+	}
 	r.GET("/users/:id", handlers.GetUser)
 	r.PUT("/users/:id", handlers.UpdateUser)
 	r.DELETE("/users/:id", handlers.DeleteUser)